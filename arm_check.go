@@ -4,116 +4,239 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math/rand"
+	"os"
+	"slices"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
 	"github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/github"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/google"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/singleflight"
 	corev1 "k8s.io/api/core/v1"
 )
 
 type ArmResult struct {
 	Supported bool
 	Err       error
+	// Containers are the results of the containers, init containers and
+	// ephemeral containers of the pod template.
+	Containers []ContainerArmResult
+}
+
+// BlockedBy returns the names of the containers whose images do not support
+// arm64.
+func (r ArmResult) BlockedBy() []string {
+	var names []string
+	for _, c := range r.Containers {
+		if c.Err == nil && !c.Supported {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+type ContainerType string
+
+const (
+	ContainerRegular   ContainerType = "container"
+	ContainerInit      ContainerType = "init"
+	ContainerEphemeral ContainerType = "ephemeral"
+)
+
+// ContainerArmResult is the ARM check result of one container image.
+type ContainerArmResult struct {
+	Name  string
+	Type  ContainerType
+	Image string
+	// Digest is the resolved digest of the image, of the index for multi-arch
+	// images.
+	Digest    string
+	Platforms []ImagePlatform
+	Supported bool
+	// Reason explains why the image does not run natively on arm64.
+	Reason string
+	Err    error
 }
 
 const MaxConcurrent = 7
 
-var armResultCache = make(map[string]ArmResult)
-var armResultCacheMutex sync.RWMutex
+// requiredArm64Variant is the arm64 variant the images must be built for, any
+// variant is accepted when it is empty.
+var requiredArm64Variant string
 
+// workloadImages are the containers of a workload and the keychain for their
+// images.
+type workloadImages struct {
+	containers []ContainerImage
+	keychain   authn.Keychain
+	err        error
+}
+
+// CheckAllWorkloadsArm checks the images of the workloads. Every unique image
+// is checked once and the result is shared by all workloads using it, a
+// sidecar image of hundreds of workloads costs a single lookup.
 func CheckAllWorkloadsArm(workloads []Workload) []ArmResult {
-	results := make([]ArmResult, len(workloads))
+	perWorkload := make([]workloadImages, len(workloads))
+	keychains := make(map[string][]authn.Keychain)
+	var unique []string
+	for i := range workloads {
+		perWorkload[i] = getWorkloadImages(&workloads[i])
+		for _, c := range perWorkload[i].containers {
+			kcs, found := keychains[c.Image]
+			if !found {
+				unique = append(unique, c.Image)
+			}
+			if !slices.Contains(kcs, perWorkload[i].keychain) {
+				keychains[c.Image] = append(kcs, perWorkload[i].keychain)
+			}
+		}
+	}
 
+	checked := make([]ContainerArmResult, len(unique))
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, MaxConcurrent)
-
-	for idx := range workloads {
+	for idx, image := range unique {
 		wg.Add(1)
 
-		go func(i int) {
+		go func(i int, image string) {
 			defer wg.Done()
 
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			cacheKey := fmt.Sprintf("%s:%s:%s", workloads[i].Kind, workloads[i].Name, workloads[i].Namespace)
+			checked[i] = checkContainerImage(image, keychains[image])
+		}(idx, image)
+	}
+	wg.Wait()
 
-			armResultCacheMutex.RLock()
-			cachedResult, found := armResultCache[cacheKey]
-			armResultCacheMutex.RUnlock()
+	if err := imageInfoCache.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save the image cache: %v\n", err)
+	}
 
-			if found {
-				results[i] = cachedResult
-				return
-			}
+	images := make(map[string]ContainerArmResult, len(unique))
+	for i, image := range unique {
+		images[image] = checked[i]
+	}
+	results := make([]ArmResult, len(workloads))
+	for i := range workloads {
+		results[i] = workloadArmResult(perWorkload[i], images)
+	}
+	return results
+}
 
-			var supported bool
-			var err error
+func getWorkloadImages(w *Workload) workloadImages {
+	if w.object == nil {
+		return workloadImages{err: fmt.Errorf("unsupported workload kind: %s", w.Kind)}
+	}
+	template, err := w.object.PodTemplate()
+	if err != nil {
+		return workloadImages{err: err}
+	}
+	// The pull secrets are read from the cluster of the workload.
+	if err := useCluster(w.Cluster); err != nil {
+		return workloadImages{err: err}
+	}
+	return workloadImages{
+		containers: getPodTemplateContainers(template.Spec),
+		keychain:   workloadKeychain(w.Namespace, &template.Spec),
+	}
+}
 
-			for {
-				supported, err = CheckWorkloadSupportsArm(&workloads[i])
-				if err != nil && strings.Contains(err.Error(), "TOOMANYREQUESTS") {
-					time.Sleep(time.Millisecond * time.Duration(rand.Int63n(800)))
-				} else {
-					break
-				}
+// workloadArmResult combines the results of the images of the workload. The
+// workload supports arm64 when all images do, an image without arm64 decides
+// the result even if other images could not be checked.
+func workloadArmResult(w workloadImages, images map[string]ContainerArmResult) ArmResult {
+	if w.err != nil {
+		return ArmResult{Err: w.err}
+	}
+
+	result := ArmResult{Supported: true}
+	for _, c := range w.containers {
+		checked := images[c.Image]
+		checked.Name, checked.Type = c.Name, c.Type
+		result.Containers = append(result.Containers, checked)
+
+		switch {
+		case checked.Err != nil:
+			if result.Err == nil {
+				result.Err = fmt.Errorf("failed to check image %s of container %s for arm64 support: %w",
+					c.Image, c.Name, checked.Err)
 			}
-			result := ArmResult{Supported: supported, Err: err}
-			results[i] = result
+		case !checked.Supported:
+			result.Supported = false
+		}
+	}
 
-			armResultCacheMutex.Lock()
-			armResultCache[cacheKey] = result
-			armResultCacheMutex.Unlock()
-		}(idx)
+	if !result.Supported {
+		// The unsupported image decides, the errors stay in the container results.
+		result.Err = nil
+	} else if result.Err != nil {
+		result.Supported = false
 	}
-	wg.Wait()
-	return results
+	return result
 }
 
-func CheckWorkloadSupportsArm(w *Workload) (bool, error) {
-	var podSpec *corev1.PodSpec
-	switch w.Kind {
-	case WorkloadDeployment:
-		podSpec = &w.deployment.Spec.Template.Spec
-	case WorkloadStatefulSet:
-		podSpec = &w.statefulSet.Spec.Template.Spec
-	default:
-		return false, fmt.Errorf("unsupported workload kind: %s", w.Kind)
-	}
-	images := getPodTemplateImages(*podSpec)
+// imageLookups makes concurrent lookups of the same image share one request.
+var imageLookups singleflight.Group
 
-	supportArm := true
-	for _, image := range images {
-		ret, err := imageSupportsArm64(image)
-		if err != nil {
-			return false, fmt.Errorf("failed to check image %s for arm64 support: %w", image, err)
-		}
-		if ret == false {
-			supportArm = false
-			break
+// checkContainerImage checks the image with the keychains of the workloads
+// using it, the next keychain is only tried when the registry denied the
+// access.
+func checkContainerImage(image string, keychains []authn.Keychain) ContainerArmResult {
+	result := ContainerArmResult{Image: image}
+	v, err, _ := imageLookups.Do(image, func() (interface{}, error) {
+		var err error
+		for _, kc := range keychains {
+			var info imageInfo
+			info, err = retryTooManyRequests(func() (imageInfo, error) {
+				return inspectImage(image, kc)
+			})
+			if err == nil {
+				return info, nil
+			}
+			if !isAccessDenied(err) {
+				break
+			}
 		}
+		return nil, err
+	})
+	if err != nil {
+		result.Err = err
+		return result
 	}
-	return supportArm, nil
+	info := v.(imageInfo)
+	result.Digest = info.Digest
+	result.Platforms = info.Platforms
+	result.Supported, result.Reason = info.arm64Support(requiredArm64Variant)
+	return result
+}
+
+// ContainerImage is a container of a pod template.
+type ContainerImage struct {
+	Name  string
+	Type  ContainerType
+	Image string
 }
 
-func getPodTemplateImages(podSpec corev1.PodSpec) []string {
-	var images []string
+func getPodTemplateContainers(podSpec corev1.PodSpec) []ContainerImage {
+	var containers []ContainerImage
 	for _, c := range podSpec.Containers {
-		images = append(images, c.Image)
+		containers = append(containers, ContainerImage{Name: c.Name, Type: ContainerRegular, Image: c.Image})
 	}
 	for _, c := range podSpec.InitContainers {
-		images = append(images, c.Image)
+		containers = append(containers, ContainerImage{Name: c.Name, Type: ContainerInit, Image: c.Image})
+	}
+	for _, c := range podSpec.EphemeralContainers {
+		containers = append(containers, ContainerImage{Name: c.Name, Type: ContainerEphemeral, Image: c.Image})
 	}
-	return images
+	return containers
 }
 
 var keychain = authn.NewMultiKeychain(
@@ -124,54 +247,218 @@ var keychain = authn.NewMultiKeychain(
 	authn.DefaultKeychain, // local ~/.docker/config.json
 )
 
-// imageSupportsArm64 checks whether the given container image supports the linux/arm64
-// platform. It returns true if the image manifest list (index) contains an arm64
-// variant, or if the single-arch image itself is built for arm64.
-func imageSupportsArm64(imageRef string) (bool, error) {
+// imageInfo describes a container image in the registry.
+type imageInfo struct {
+	Digest string `json:"digest"`
+	// Platforms are the platforms of the images of an index, without the
+	// attestation manifests, or the platform of the single image.
+	Platforms []ImagePlatform `json:"platforms"`
+}
+
+// ImagePlatform is a platform an image is built for.
+type ImagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OSVersion    string `json:"osVersion,omitempty"`
+	// Mismatch explains why the linux/arm64 image of an index does not run
+	// natively on arm64, e.g. its config is built for another architecture.
+	Mismatch string `json:"mismatch,omitempty"`
+}
+
+func (p ImagePlatform) String() string {
+	platform := formatPlatform(p.OS, p.Architecture, p.Variant)
+	if p.OSVersion != "" {
+		platform += " (" + p.OSVersion + ")"
+	}
+	if p.Mismatch != "" {
+		platform += ": " + p.Mismatch
+	}
+	return platform
+}
+
+func (p ImagePlatform) isLinuxArm64() bool {
+	return strings.EqualFold(p.OS, "linux") && p.Architecture == "arm64"
+}
+
+// arm64Variant returns the variant of an arm64 platform, v8 when it is not
+// set.
+func (p ImagePlatform) arm64Variant() string {
+	if p.Variant == "" {
+		return "v8"
+	}
+	return p.Variant
+}
+
+// arm64Support reports whether the image has a linux/arm64 image of the
+// variant which runs natively, and the reason when it has not.
+func (i imageInfo) arm64Support(variant string) (bool, string) {
+	reason := "no linux/arm64 image"
+	for _, platform := range i.Platforms {
+		if !platform.isLinuxArm64() {
+			continue
+		}
+		if variant != "" && platform.arm64Variant() != variant {
+			reason = fmt.Sprintf("linux/arm64 image is variant %s, %s is required", platform.arm64Variant(), variant)
+			continue
+		}
+		if platform.Mismatch != "" {
+			reason = "linux/arm64 image " + platform.Mismatch
+			continue
+		}
+		return true, ""
+	}
+	return false, reason
+}
+
+func formatPlatform(os, architecture, variant string) string {
+	platform := strings.ToLower(os) + "/" + architecture
+	if variant != "" {
+		platform += "/" + variant
+	}
+	return platform
+}
+
+// inspectImage resolves the digest of the given container image and the
+// platforms it is built for, authenticating with the keychain. The platforms
+// of a digest are immutable and taken from the image cache, a tag is resolved
+// to its digest with a HEAD request once its cache entry expired.
+func inspectImage(imageRef string, kc authn.Keychain) (imageInfo, error) {
 	// Parse an arbitrary image reference (registry/name:tag or digest).
 	ref, err := name.ParseReference(imageRef, name.WeakValidation)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse image reference: %w", err)
+		return imageInfo{}, fmt.Errorf("failed to parse image reference: %w", err)
 	}
 
-	// Pull the descriptor (manifest or index) from the remote registry.
-	remoteOpts := []remote.Option{
-		remote.WithAuthFromKeychain(keychain),
+	// The image is fetched from its mirror, the cache uses the original
+	// reference.
+	fetchRef, registryOpts, err := registries.resolve(ref)
+	if err != nil {
+		return imageInfo{}, err
+	}
+	remoteOpts := append([]remote.Option{
+		remote.WithAuthFromKeychain(kc),
 		remote.WithContext(context.Background()),
+	}, registryOpts...)
+
+	tag := ""
+	if digest, ok := ref.(name.Digest); ok {
+		if info, found := imageInfoCache.digest(digest.DigestStr()); found {
+			return info, nil
+		}
+	} else {
+		// A tag can be pushed again, so it is always resolved. The cached
+		// digest of the tag is only used when the registry can not be reached.
+		tag = ref.Name()
+		desc, err := remote.Head(fetchRef, remoteOpts...)
+		if err == nil {
+			if info, found := imageInfoCache.digest(desc.Digest.String()); found {
+				imageInfoCache.put(tag, info)
+				return info, nil
+			}
+		} else if info, found := imageInfoCache.tag(tag); found {
+			return info, nil
+		}
 	}
+
+	info, err := fetchImageInfo(fetchRef, remoteOpts)
+	if err != nil {
+		return imageInfo{}, err
+	}
+	imageInfoCache.put(tag, info)
+	return info, nil
+}
+
+// fetchImageInfo reads the platforms from the manifest list (index) of
+// multi-arch images or from the config of a single-arch image.
+func fetchImageInfo(ref name.Reference, remoteOpts []remote.Option) (imageInfo, error) {
+	// Pull the descriptor (manifest or index) from the remote registry.
 	desc, err := remote.Get(ref, remoteOpts...)
 	if err != nil {
-		return false, fmt.Errorf("failed to fetch image descriptor: %w", err)
+		return imageInfo{}, fmt.Errorf("failed to fetch image descriptor: %w", err)
 	}
+	info := imageInfo{Digest: desc.Digest.String()}
 
 	mt := desc.Descriptor.MediaType
 	// Handle multi-arch images (OCI index / Docker manifest list).
 	if mt == types.OCIImageIndex || mt == types.DockerManifestList {
 		idx, err := desc.ImageIndex()
 		if err != nil {
-			return false, fmt.Errorf("failed to load image index: %w", err)
+			return imageInfo{}, fmt.Errorf("failed to load image index: %w", err)
 		}
 		indexManifest, err := idx.IndexManifest()
 		if err != nil {
-			return false, fmt.Errorf("failed to read index manifest: %w", err)
+			return imageInfo{}, fmt.Errorf("failed to read index manifest: %w", err)
 		}
 		for _, manifest := range indexManifest.Manifests {
 			plat := manifest.Platform
-			if plat != nil && plat.Architecture == "arm64" && strings.EqualFold(plat.OS, "linux") {
-				return true, nil // linux/arm64 variant found
+			if plat == nil || isAttestationManifest(manifest) {
+				continue
+			}
+			platform := ImagePlatform{
+				OS:           plat.OS,
+				Architecture: plat.Architecture,
+				Variant:      plat.Variant,
+				OSVersion:    plat.OSVersion,
+			}
+			if platform.isLinuxArm64() && manifest.MediaType.IsImage() {
+				if platform.Mismatch, err = verifyArm64Image(idx, manifest.Digest); err != nil {
+					return imageInfo{}, err
+				}
 			}
+			info.Platforms = append(info.Platforms, platform)
 		}
-		return false, nil // no arm64 variant in the index
+		return info, nil
 	}
 
 	// Handle single-arch images.
 	img, err := desc.Image()
 	if err != nil {
-		return false, fmt.Errorf("failed to load image: %w", err)
+		return imageInfo{}, fmt.Errorf("failed to load image: %w", err)
 	}
 	cfg, err := img.ConfigFile()
 	if err != nil {
-		return false, fmt.Errorf("failed to read image config: %w", err)
+		return imageInfo{}, fmt.Errorf("failed to read image config: %w", err)
+	}
+	info.Platforms = []ImagePlatform{{
+		OS:           cfg.OS,
+		Architecture: cfg.Architecture,
+		Variant:      cfg.Variant,
+		OSVersion:    cfg.OSVersion,
+	}}
+	return info, nil
+}
+
+// isAttestationManifest reports whether the index entry is a build attestation
+// (provenance or SBOM), which buildkit adds with the platform unknown/unknown.
+func isAttestationManifest(manifest v1.Descriptor) bool {
+	if manifest.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+		return true
+	}
+	return manifest.Platform.OS == "unknown" && manifest.Platform.Architecture == "unknown"
+}
+
+// verifyArm64Image checks that the linux/arm64 entry of an index really is an
+// arm64 image: a config of another architecture only runs with emulation and
+// an image without layers is a stub.
+func verifyArm64Image(idx v1.ImageIndex, digest v1.Hash) (string, error) {
+	img, err := idx.Image(digest)
+	if err != nil {
+		return "", fmt.Errorf("failed to load arm64 image %s: %w", digest, err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return "", fmt.Errorf("failed to read config of arm64 image %s: %w", digest, err)
+	}
+	if !strings.EqualFold(cfg.OS, "linux") || cfg.Architecture != "arm64" {
+		return "config is built for " + formatPlatform(cfg.OS, cfg.Architecture, cfg.Variant), nil
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return "", fmt.Errorf("failed to read layers of arm64 image %s: %w", digest, err)
+	}
+	if len(layers) == 0 {
+		return "has no layers", nil
 	}
-	return cfg.Architecture == "arm64", nil
+	return "", nil
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestArm64Support(t *testing.T) {
+	amd64 := ImagePlatform{OS: "linux", Architecture: "amd64"}
+	arm64 := ImagePlatform{OS: "linux", Architecture: "arm64"}
+	arm64v9 := ImagePlatform{OS: "linux", Architecture: "arm64", Variant: "v9"}
+	windowsArm64 := ImagePlatform{OS: "windows", Architecture: "arm64"}
+	emulated := ImagePlatform{OS: "linux", Architecture: "arm64", Mismatch: "config is built for linux/amd64"}
+
+	tests := []struct {
+		name       string
+		platforms  []ImagePlatform
+		variant    string
+		want       bool
+		wantReason string
+	}{
+		{name: "multi-arch", platforms: []ImagePlatform{amd64, arm64}, want: true},
+		{name: "amd64 only", platforms: []ImagePlatform{amd64}, wantReason: "no linux/arm64 image"},
+		{name: "no platforms", wantReason: "no linux/arm64 image"},
+		{name: "windows arm64", platforms: []ImagePlatform{windowsArm64}, wantReason: "no linux/arm64 image"},
+		{name: "default variant is v8", platforms: []ImagePlatform{arm64}, variant: "v8", want: true},
+		{name: "other variant", platforms: []ImagePlatform{arm64}, variant: "v9",
+			wantReason: "linux/arm64 image is variant v8, v9 is required"},
+		{name: "one of the variants", platforms: []ImagePlatform{arm64, arm64v9}, variant: "v9", want: true},
+		{name: "mismatched config", platforms: []ImagePlatform{amd64, emulated},
+			wantReason: "linux/arm64 image config is built for linux/amd64"},
+		{name: "mismatched and valid entry", platforms: []ImagePlatform{emulated, arm64}, want: true},
+	}
+	for _, tt := range tests {
+		got, reason := imageInfo{Platforms: tt.platforms}.arm64Support(tt.variant)
+		if got != tt.want || reason != tt.wantReason {
+			t.Errorf("%s: arm64Support(%q) = %v, %q, want %v, %q", tt.name, tt.variant, got, reason, tt.want, tt.wantReason)
+		}
+	}
+}
+
+func TestIsAttestationManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest v1.Descriptor
+		want     bool
+	}{
+		{name: "image", manifest: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+		{name: "annotated attestation", manifest: v1.Descriptor{
+			Platform:    &v1.Platform{OS: "linux", Architecture: "arm64"},
+			Annotations: map[string]string{"vnd.docker.reference.type": "attestation-manifest"},
+		}, want: true},
+		{name: "unknown platform", manifest: v1.Descriptor{Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"}},
+			want: true},
+	}
+	for _, tt := range tests {
+		if got := isAttestationManifest(tt.manifest); got != tt.want {
+			t.Errorf("%s: isAttestationManifest() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testImage(t *testing.T, architecture string, layers int) v1.Image {
+	t.Helper()
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{OS: "linux", Architecture: architecture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range layers {
+		var buf bytes.Buffer
+		if err := tar.NewWriter(&buf).Close(); err != nil {
+			t.Fatal(err)
+		}
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.AppendLayers(img, layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return img
+}
+
+func TestVerifyArm64Image(t *testing.T) {
+	tests := []struct {
+		name         string
+		architecture string
+		layers       int
+		want         string
+	}{
+		{name: "arm64 image", architecture: "arm64", layers: 1},
+		{name: "amd64 config", architecture: "amd64", layers: 1, want: "config is built for linux/amd64"},
+		{name: "stub without layers", architecture: "arm64", want: "has no layers"},
+	}
+	for _, tt := range tests {
+		img := testImage(t, tt.architecture, tt.layers)
+		idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+		})
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := verifyArm64Image(idx, manifest.Manifests[0].Digest)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: verifyArm64Image() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"interactive", "Run the interactive menu (default)", runInteractive},
+	{"list", "List the selected workloads", runList},
+	{"migrate", "Migrate the selected workloads", workloadActionCommand("migrate", migrateWorkload)},
+	{"rollback", "Rollback the migration of the selected workloads", workloadActionCommand("rollback", rollbackWorkload)},
+	{"arm-patch", "Patch ARM affinity and toleration into the selected workloads",
+		workloadActionCommand("arm-patch", patchWorkloadARMAffinity)},
+	{"arm-rollback", "Rollback ARM affinity and toleration of the selected workloads",
+		workloadActionCommand("arm-rollback", rollbackWorkloadARMAffinity)},
+	{"arm-check", "Check whether the images of the selected workloads support arm64", runARMCheck},
+	{"plan", "Write the merge patches of an action on the selected workloads to a plan file", runPlan},
+	{"apply", "Apply a plan file, resuming after the completed items", runApply},
+}
+
+// runCommand dispatches the subcommand in args and returns the process exit code.
+// Without a subcommand the interactive menu is started, so existing invocations
+// like `migrate --kubeconfig ~/.kube/config` keep working.
+func runCommand(args []string) int {
+	name := "interactive"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage()
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args)
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var usageErr *usageError
+		if errors.As(err, &usageErr) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", name)
+	printUsage()
+	return exitUsage
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: migrate [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'migrate <command> -h' for the flags of a command.")
+}
+
+type usageError struct {
+	err error
+}
+
+func newUsageError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return &usageError{err: err}
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+
+func (e *usageError) Unwrap() error { return e.err }
+
+// workloadFailures is returned by the workload actions when some of the
+// selected workloads could not be processed.
+type workloadFailures struct {
+	failed  int
+	skipped int
+	total   int
+}
+
+func newWorkloadFailures(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+	return &workloadFailures{failed: failed, total: total}
+}
+
+func (e *workloadFailures) Error() string {
+	if e.skipped > 0 {
+		return fmt.Sprintf("%d of %d workloads failed, %d skipped", e.failed, e.total, e.skipped)
+	}
+	return fmt.Sprintf("%d of %d workloads failed", e.failed, e.total)
+}
+
+// globalOptions are the flags shared by all commands.
+type globalOptions struct {
+	kube       kubeOptions
+	configPath string
+}
+
+func (o *globalOptions) addFlags(fs *flag.FlagSet) {
+	o.kube.addFlags(fs)
+	imageCacheConfig.addFlags(fs)
+	registryLimits.addFlags(fs)
+	fs.StringVar(&requiredArm64Variant, "arm64-variant", "",
+		"arm64 variant the images must be built for, e.g. v8, an arm64 image without variant is v8")
+	fs.StringVar(&o.configPath, "config", "", "path to the configuration file, e.g. to declare custom workload kinds")
+}
+
+// init loads the configuration file, registers the custom workload kinds,
+// configures the registries and creates the kubernetes clients.
+func (o *globalOptions) init() error {
+	config, err := loadConfig(o.configPath)
+	if err != nil {
+		return err
+	}
+	if err := registerCustomWorkloads(config.CustomWorkloads); err != nil {
+		return err
+	}
+	if err := configureRegistries(config); err != nil {
+		return err
+	}
+	if err := initKubeClients(&o.kube); err != nil {
+		return fmt.Errorf("failed to create kubernetes client, err: %w", err)
+	}
+	return nil
+}
+
+// loadSelectedWorkloads parses the common flags of a subcommand, connects to the
+// cluster and returns the workloads matching the selector flags.
+func loadSelectedWorkloads(fs *flag.FlagSet, args []string, requireSelector bool) ([]Workload, error) {
+	opts := &globalOptions{}
+	opts.addFlags(fs)
+	all := fs.Bool("all", false, "select all workloads")
+	from := fs.String("from", "", "select the workloads of the JSON or YAML output of list or arm-check, - reads stdin")
+	selectorFlags := addSelectorFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, newUsageError(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, newUsageError(fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " ")))
+	}
+
+	selectorValues := make(map[string]string, len(selectorFlags))
+	for key, value := range selectorFlags {
+		selectorValues[key] = *value
+	}
+	selector, err := newWorkloadSelector(selectorValues)
+	if err != nil {
+		return nil, newUsageError(err)
+	}
+	if requireSelector && !*all && *from == "" && selector.IsEmpty() {
+		return nil, newUsageError(fmt.Errorf("no workload selected, use --all or the selector flags"))
+	}
+
+	var listed []WorkloadRecord
+	if *from != "" {
+		if listed, err = readWorkloadList(*from); err != nil {
+			return nil, err
+		}
+	}
+
+	// Plain namespaces scope the listing, so no cluster-wide permissions are
+	// needed.
+	if namespaces, ok := selector.Namespaces.names(); ok {
+		opts.kube.scopeNamespaces(namespaces)
+	}
+	if err := opts.init(); err != nil {
+		return nil, err
+	}
+
+	workloads, err = getAllWorkloads()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workloads, err: %w", err)
+	}
+	candidates := workloads
+	if *from != "" {
+		candidates = selectListedWorkloads(workloads, listed)
+	}
+	return selector.Select(candidates)
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	format := addOutputFlag(fs)
+	selectedWorkloads, err := loadSelectedWorkloads(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	return printWorkloads(selectedWorkloads, CheckAllWorkloadsArm(selectedWorkloads), *format)
+}
+
+func runARMCheck(args []string) error {
+	fs := flag.NewFlagSet("arm-check", flag.ContinueOnError)
+	format := addOutputFlag(fs)
+	details := fs.Bool("details", false, "print the image, digest, platforms and result of every container")
+	selectedWorkloads, err := loadSelectedWorkloads(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	results := CheckAllWorkloadsArm(selectedWorkloads)
+	if err := printWorkloads(selectedWorkloads, results, *format); err != nil {
+		return err
+	}
+	if *details && !format.machineReadable() {
+		printArmDetails(selectedWorkloads, results)
+	}
+
+	out := messageOutput(*format)
+	failed := 0
+	for i, result := range results {
+		w := selectedWorkloads[i]
+		switch {
+		case result.Err != nil:
+			if *format != OutputTable {
+				fmt.Fprintf(out, "failed to check arm support for workload %s %s/%s: %v\n", w.Kind, w.Namespace, w.Name, result.Err)
+			}
+			failed++
+		case !result.Supported:
+			fmt.Fprintf(out, "workload %s %s/%s does not support arm64, blocked by: %s\n", w.Kind, w.Namespace, w.Name,
+				strings.Join(result.BlockedBy(), ", "))
+			failed++
+		}
+	}
+	return newWorkloadFailures(failed, len(selectedWorkloads))
+}
+
+func workloadActionCommand(name string, action func([]Workload) error) func(args []string) error {
+	return func(args []string) error {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		addDryRunFlag(fs)
+		addRolloutWaitFlags(fs)
+		addWaveFlags(fs)
+		selectedWorkloads, err := loadSelectedWorkloads(fs, args, true)
+		if err != nil {
+			return err
+		}
+		if len(selectedWorkloads) == 0 {
+			fmt.Println("No workload matches the selector.")
+			return nil
+		}
+
+		printSelectedWorkloadsTable(selectedWorkloads, "")
+		return action(selectedWorkloads)
+	}
+}
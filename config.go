@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the optional configuration file passed with --config.
+type Config struct {
+	// CustomWorkloads declares the workload kinds served by CRDs, like Argo
+	// Rollouts or OpenKruise CloneSets.
+	CustomWorkloads []CustomWorkloadConfig `json:"customWorkloads,omitempty"`
+
+	// Mirrors rewrite the image references before the images are inspected,
+	// the first mirror whose prefix matches is used.
+	Mirrors []MirrorConfig `json:"mirrors,omitempty"`
+	// Registries configure the connections to registries and mirrors.
+	Registries []RegistryConfig `json:"registries,omitempty"`
+}
+
+// MirrorConfig maps a registry or repository prefix, like docker.io or
+// gcr.io/project, to the mirror which serves it, like mirror.internal:5000/dockerhub.
+type MirrorConfig struct {
+	Prefix string `json:"prefix"`
+	Mirror string `json:"mirror"`
+}
+
+// RegistryConfig configures the connection to the registry or mirror Host,
+// including the port if it is not the default one.
+type RegistryConfig struct {
+	Host string `json:"host"`
+	// PlainHTTP connects without TLS.
+	PlainHTTP bool `json:"plainHTTP,omitempty"`
+	// InsecureSkipVerify does not verify the certificate of the registry.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// CAFile is a PEM bundle of CAs trusted in addition to the system ones.
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// CustomWorkloadConfig declares a custom resource which manages pods through a
+// pod template. The paths are dot separated field paths, the JSONPath forms
+// `.spec.template` and `{.spec.template}` are accepted as well.
+type CustomWorkloadConfig struct {
+	Kind     string `json:"kind"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+
+	// PodTemplatePath defaults to spec.template.
+	PodTemplatePath string `json:"podTemplatePath,omitempty"`
+	// SelectorPath defaults to spec.selector.
+	SelectorPath string `json:"selectorPath,omitempty"`
+	// ReplicasPath defaults to spec.replicas, a missing value means 1 replica.
+	ReplicasPath string `json:"replicasPath,omitempty"`
+	// ReadyReplicasPath defaults to status.readyReplicas.
+	ReadyReplicasPath string `json:"readyReplicasPath,omitempty"`
+	// AvailableReplicasPath defaults to status.availableReplicas.
+	AvailableReplicasPath string `json:"availableReplicasPath,omitempty"`
+	// ObservedGenerationPath defaults to status.observedGeneration, the workload
+	// is only ready when the observed generation is the current one.
+	ObservedGenerationPath string `json:"observedGenerationPath,omitempty"`
+	// UpdatedReplicasPath defaults to status.updatedReplicas, the workload is
+	// only ready when all replicas run the current template. The old pods of a
+	// rollout are still ready, so the ready replicas alone do not tell.
+	UpdatedReplicasPath string `json:"updatedReplicasPath,omitempty"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return config, nil
+}
@@ -1,23 +1,42 @@
 package main
 
 import (
-	appsv1 "k8s.io/api/apps/v1"
+	"errors"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Workload struct {
+	// Cluster is the kubeconfig context of the workload with --contexts.
+	Cluster        string
 	Name           string
 	Namespace      string
 	Kind           WorkloadKind
+	Labels         map[string]string
 	Replicas       int32
 	Available      int32
 	Ready          bool
 	MigratePatched bool
 	ARMPatched     bool
-	Priority       int32
-	deployment     *appsv1.Deployment
-	statefulSet    *appsv1.StatefulSet
+	// Priority is the priority the pod template resolves to, PriorityUnknown is
+	// set when the priority classes could not be read.
+	Priority        int32
+	PriorityUnknown bool
+	// PodPriorities are the priorities of the pods when they differ from the
+	// priority of the template, e.g. in the middle of a rollout.
+	PodPriorities []int32
+	// Pods are the pods of the workload, found through its selector and the
+	// owner references.
+	Pods []WorkloadPod
+	// LastScheduleTime and LastSuccessfulTime are only set for CronJobs
+	LastScheduleTime   *metav1.Time
+	LastSuccessfulTime *metav1.Time
+	object             WorkloadObject
+	// patchedVersion is the resource version the workload had before its last
+	// patch, the rollout is read from the inventory once it is newer.
+	patchedVersion string
 }
 
 type WorkloadKind string
@@ -25,8 +44,18 @@ type WorkloadKind string
 const (
 	WorkloadDeployment  WorkloadKind = "Deployment"
 	WorkloadStatefulSet WorkloadKind = "StatefulSet"
+	WorkloadDaemonSet   WorkloadKind = "DaemonSet"
+	// WorkloadReplicaSet only covers the ReplicaSets which are not controlled by a Deployment.
+	WorkloadReplicaSet WorkloadKind = "ReplicaSet"
+	WorkloadCronJob    WorkloadKind = "CronJob"
+	// WorkloadJob only covers the Jobs which are not created by a CronJob.
+	WorkloadJob WorkloadKind = "Job"
 )
 
+// ErrJobTemplateImmutable is returned when patching a Job, the pod template of a
+// Job can not be changed after the creation.
+var ErrJobTemplateImmutable = errors.New("the pod template of a Job is immutable, patch its CronJob or recreate it instead")
+
 var MigrateToleration = []corev1.Toleration{
 	//{
 	//	Key:      "cloudpilot.ai/provider-disable",
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"sigs.k8s.io/yaml"
+)
+
+type DryRunMode string
+
+const (
+	// DryRunNone sends the patches to the cluster.
+	DryRunNone DryRunMode = "none"
+	// DryRunClient only prints the patches and the pod template diffs.
+	DryRunClient DryRunMode = "client"
+	// DryRunServer prints the patches and sends them with `DryRun: All`, so that
+	// the validation and admission webhooks run without persisting the change.
+	DryRunServer DryRunMode = "server"
+)
+
+var dryRunMode = DryRunNone
+
+func (m *DryRunMode) String() string { return string(*m) }
+
+func (m *DryRunMode) Set(value string) error {
+	switch DryRunMode(value) {
+	case DryRunNone, DryRunClient, DryRunServer:
+		*m = DryRunMode(value)
+	case "true":
+		*m = DryRunClient
+	case "false":
+		*m = DryRunNone
+	default:
+		return fmt.Errorf("must be one of none, client or server")
+	}
+	return nil
+}
+
+// IsBoolFlag allows `--dry-run` without a value, which means client dry run.
+func (m *DryRunMode) IsBoolFlag() bool { return true }
+
+func addDryRunFlag(fs *flag.FlagSet) {
+	fs.Var(&dryRunMode, "dry-run", "one of none, client or server; client only prints the patches, "+
+		"server also sends them with DryRun: All to run the validation without persisting")
+}
+
+const diffContextLines = 3
+
+// printPatchPreview prints the merge patch and the YAML diff of the pod template
+// of a workload for the review before it is applied.
+func printPatchPreview(originalObj, updatedObj WorkloadObject, namespace, name string, kind WorkloadKind, patch []byte) {
+	fmt.Printf("\n--- %s %s/%s\n", kind, namespace, name)
+	fmt.Printf("Merge patch:\n%s\n", patch)
+
+	originalYAML, err := podTemplateYAML(originalObj)
+	if err != nil {
+		fmt.Printf("Failed to render the pod template diff: %v\n", err)
+		return
+	}
+	updatedYAML, err := podTemplateYAML(updatedObj)
+	if err != nil {
+		fmt.Printf("Failed to render the pod template diff: %v\n", err)
+		return
+	}
+	fmt.Println("Pod template diff:")
+	fmt.Print(diffLines(originalYAML, updatedYAML))
+}
+
+func podTemplateYAML(obj WorkloadObject) (string, error) {
+	template, err := obj.PodTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// diffLines returns a unified style line diff of a and b with a few lines of
+// context around every change.
+func diffLines(a, b string) string {
+	aLines := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	bLines := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of aLines[i:] and bLines[j:].
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		line string
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			lines = append(lines, diffLine{' ', aLines[i]})
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', aLines[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', bLines[j]})
+			j++
+		}
+	}
+
+	// Only keep the lines close enough to a change.
+	keep := make([]bool, len(lines))
+	for idx, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		for k := max(0, idx-diffContextLines); k <= min(len(lines)-1, idx+diffContextLines); k++ {
+			keep[k] = true
+		}
+	}
+
+	var sb strings.Builder
+	skipped := false
+	for idx, l := range lines {
+		if !keep[idx] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString(text.Colors{text.FgCyan}.Sprint("...") + "\n")
+			skipped = false
+		}
+		switch l.op {
+		case '+':
+			sb.WriteString(text.Colors{text.FgGreen}.Sprint("+ "+l.line) + "\n")
+		case '-':
+			sb.WriteString(text.Colors{text.FgRed}.Sprint("- "+l.line) + "\n")
+		default:
+			sb.WriteString("  " + l.line + "\n")
+		}
+	}
+	if skipped && sb.Len() > 0 {
+		sb.WriteString(text.Colors{text.FgCyan}.Sprint("...") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+func TestDryRunModeSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DryRunMode
+		wantErr bool
+	}{
+		{value: "none", want: DryRunNone},
+		{value: "client", want: DryRunClient},
+		{value: "server", want: DryRunServer},
+		{value: "true", want: DryRunClient},
+		{value: "false", want: DryRunNone},
+		{value: "all", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		mode := DryRunNone
+		err := mode.Set(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && mode != tt.want {
+			t.Errorf("Set(%q) = %q, want %q", tt.value, mode, tt.want)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	text.DisableColors()
+	defer text.EnableColors()
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "equal", a: "a\nb\n", b: "a\nb\n", want: ""},
+		{name: "changed line", a: "a\nb\nc\n", b: "a\nx\nc\n", want: "  a\n- b\n+ x\n  c\n"},
+		{name: "added line", a: "a\n", b: "a\nb\n", want: "  a\n+ b\n"},
+		{name: "removed line", a: "a\nb\n", b: "b\n", want: "- a\n  b\n"},
+		{name: "context is cut", a: "1\n2\n3\n4\n5\n6\n", b: "1\n2\n3\n4\n5\nx\n",
+			want: "...\n  3\n  4\n  5\n- 6\n+ x\n"},
+		{name: "context after the change is cut", a: "x\n1\n2\n3\n4\n5\n", b: "1\n2\n3\n4\n5\n",
+			want: "- x\n  1\n  2\n  3\n...\n"},
+	}
+	for _, tt := range tests {
+		if got := diffLines(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: diffLines() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// fleetCluster is a kubeconfig context of --contexts with its clients and
+// caches.
+type fleetCluster struct {
+	name          string
+	kubeClient    *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	inventory     *inventoryCache
+	pullSecrets   *pullSecrets
+}
+
+// fleet are the clusters of --contexts, it is empty when a single cluster is
+// used.
+var fleet []*fleetCluster
+
+// currentCluster is the name of the cluster in use, empty without --contexts.
+var currentCluster string
+
+func fleetMode() bool {
+	return len(fleet) > 0
+}
+
+// fleetClusterNames returns the names of the clusters of the fleet, or the
+// single cluster without a name.
+func fleetClusterNames() []string {
+	if !fleetMode() {
+		return []string{""}
+	}
+	names := make([]string, 0, len(fleet))
+	for _, c := range fleet {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// useCluster switches the clients and caches to the cluster of the fleet. The
+// clusters are used one after the other, the workloads remember their
+// cluster. Without --contexts only the empty name is valid.
+func useCluster(name string) error {
+	if !fleetMode() {
+		if name != "" {
+			return fmt.Errorf("cluster %s requires --contexts", name)
+		}
+		return nil
+	}
+	for _, c := range fleet {
+		if c.name == name {
+			kubeClient = c.kubeClient
+			dynamicClient = c.dynamicClient
+			currentInventory = c.inventory
+			clusterPullSecrets = c.pullSecrets
+			currentCluster = c.name
+			return nil
+		}
+	}
+	return fmt.Errorf("cluster %s is not one of --contexts", name)
+}
+
+// insertClusterColumn inserts the cluster column at the index of the row with
+// --contexts.
+func insertClusterColumn(row table.Row, index int, cluster interface{}) table.Row {
+	if !fleetMode() {
+		return row
+	}
+	return slices.Insert(row, index, cluster)
+}
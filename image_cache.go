@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type imageCacheOptions struct {
+	path string
+	// tagTTL is how long the digest a tag resolved to is used when the tag can
+	// not be resolved again.
+	tagTTL time.Duration
+}
+
+var imageCacheConfig = imageCacheOptions{path: defaultImageCachePath(), tagTTL: time.Hour}
+
+func defaultImageCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "migrate", "images.json")
+}
+
+func (o *imageCacheOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.path, "image-cache", o.path, "file which caches the platforms of the images across runs, empty to disable")
+	fs.DurationVar(&o.tagTTL, "image-cache-ttl", o.tagTTL,
+		"how long the digest of an image tag is used when the registry can not resolve it, "+
+			"the platforms of a digest are cached forever")
+}
+
+// imageCacheVersion is increased when the cached image details change, the
+// cache of another version is dropped.
+const imageCacheVersion = 2
+
+// imageCache caches the platforms of the images by digest, which is immutable,
+// and the digests the tags resolved to, which are a fallback for the TTL.
+type imageCache struct {
+	mu     sync.Mutex
+	loaded bool
+	dirty  bool
+
+	Version int                      `json:"version"`
+	Tags    map[string]imageTagEntry `json:"tags"`
+	Digests map[string]imageInfo     `json:"digests"`
+}
+
+type imageTagEntry struct {
+	Digest     string    `json:"digest"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+var imageInfoCache = &imageCache{}
+
+// load reads the cache file once, a missing or broken file or a file of
+// another version starts an empty cache. It must be called with the lock held.
+func (c *imageCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.Tags = make(map[string]imageTagEntry)
+	c.Digests = make(map[string]imageInfo)
+	if imageCacheConfig.path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(imageCacheConfig.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Failed to read the image cache %s: %v\n", imageCacheConfig.path, err)
+		}
+		return
+	}
+	var version struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &version); err == nil && version.Version != imageCacheVersion {
+		return
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		fmt.Fprintf(os.Stderr, "Ignore the broken image cache %s: %v\n", imageCacheConfig.path, err)
+		c.Tags = make(map[string]imageTagEntry)
+		c.Digests = make(map[string]imageInfo)
+	}
+}
+
+// tag returns the cached image of the tag if it was resolved within the TTL.
+func (c *imageCache) tag(ref string) (imageInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	entry, ok := c.Tags[ref]
+	if !ok || time.Since(entry.ResolvedAt) > imageCacheConfig.tagTTL {
+		return imageInfo{}, false
+	}
+	info, ok := c.Digests[entry.Digest]
+	return info, ok
+}
+
+func (c *imageCache) digest(digest string) (imageInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	info, ok := c.Digests[digest]
+	return info, ok
+}
+
+// put caches the image, and the digest the tag resolved to unless ref is empty.
+func (c *imageCache) put(ref string, info imageInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	c.Digests[info.Digest] = info
+	if ref != "" {
+		c.Tags[ref] = imageTagEntry{Digest: info.Digest, ResolvedAt: time.Now()}
+	}
+	c.dirty = true
+}
+
+// save writes the cache file if it changed, dropping the expired tags.
+func (c *imageCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty || imageCacheConfig.path == "" {
+		return nil
+	}
+
+	c.Version = imageCacheVersion
+	for ref, entry := range c.Tags {
+		if time.Since(entry.ResolvedAt) > imageCacheConfig.tagTTL {
+			delete(c.Tags, ref)
+		}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(imageCacheConfig.path), 0o755); err != nil {
+		return fmt.Errorf("create image cache dir: %w", err)
+	}
+	tmp := imageCacheConfig.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write image cache: %w", err)
+	}
+	if err := os.Rename(tmp, imageCacheConfig.path); err != nil {
+		return fmt.Errorf("write image cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testImageCacheConfig(t *testing.T) string {
+	t.Helper()
+	previous := imageCacheConfig
+	t.Cleanup(func() { imageCacheConfig = previous })
+	imageCacheConfig = imageCacheOptions{path: filepath.Join(t.TempDir(), "images.json"), tagTTL: time.Hour}
+	return imageCacheConfig.path
+}
+
+func TestImageCacheTagTTL(t *testing.T) {
+	testImageCacheConfig(t)
+	nginx := imageInfo{Digest: "sha256:1", Platforms: []ImagePlatform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}}}
+
+	tests := []struct {
+		name       string
+		resolvedAt time.Duration
+		wantTag    bool
+	}{
+		{name: "just resolved", wantTag: true},
+		{name: "within the TTL", resolvedAt: 59 * time.Minute, wantTag: true},
+		{name: "expired", resolvedAt: 61 * time.Minute},
+	}
+	for _, tt := range tests {
+		cache := &imageCache{}
+		cache.put("docker.io/library/nginx:1.25", nginx)
+		cache.Tags["docker.io/library/nginx:1.25"] = imageTagEntry{
+			Digest:     nginx.Digest,
+			ResolvedAt: time.Now().Add(-tt.resolvedAt),
+		}
+
+		if _, found := cache.tag("docker.io/library/nginx:1.25"); found != tt.wantTag {
+			t.Errorf("%s: tag() found = %v, want %v", tt.name, found, tt.wantTag)
+		}
+		if _, found := cache.digest(nginx.Digest); !found {
+			t.Errorf("%s: digest() is not found, digests never expire", tt.name)
+		}
+	}
+}
+
+func TestImageCacheSave(t *testing.T) {
+	path := testImageCacheConfig(t)
+	cache := &imageCache{}
+	cache.put("docker.io/library/nginx:1.25", imageInfo{Digest: "sha256:1", Platforms: []ImagePlatform{{OS: "linux", Architecture: "arm64"}}})
+	cache.put("docker.io/library/redis:7", imageInfo{Digest: "sha256:2", Platforms: []ImagePlatform{{OS: "linux", Architecture: "amd64"}}})
+	cache.put("", imageInfo{Digest: "sha256:3", Platforms: []ImagePlatform{{OS: "linux", Architecture: "amd64"}}})
+	cache.Tags["docker.io/library/redis:7"] = imageTagEntry{Digest: "sha256:2", ResolvedAt: time.Now().Add(-2 * time.Hour)}
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &imageCache{}
+	if _, found := loaded.tag("docker.io/library/nginx:1.25"); !found {
+		t.Errorf("tag resolved within the TTL is not saved")
+	}
+	if _, found := loaded.Tags["docker.io/library/redis:7"]; found {
+		t.Errorf("expired tag is saved")
+	}
+	for _, digest := range []string{"sha256:1", "sha256:2", "sha256:3"} {
+		if _, found := loaded.digest(digest); !found {
+			t.Errorf("digest %s is not saved", digest)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := &imageCache{}
+	if _, found := broken.digest("sha256:1"); found {
+		t.Errorf("broken cache file is used")
+	}
+}
+
+func TestImageCacheVersion(t *testing.T) {
+	path := testImageCacheConfig(t)
+	tests := []struct {
+		name    string
+		version int
+		want    bool
+	}{
+		{name: "current version", version: imageCacheVersion, want: true},
+		{name: "old version", version: imageCacheVersion - 1},
+		{name: "without version", version: 0},
+	}
+	for _, tt := range tests {
+		data := fmt.Sprintf(`{"version": %d, "digests": {"sha256:1": {"digest": "sha256:1"}}}`, tt.version)
+		if tt.version == 0 {
+			data = `{"digests": {"sha256:1": {"digest": "sha256:1", "platforms": ["linux/arm64"]}}}`
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cache := &imageCache{}
+		if _, found := cache.digest("sha256:1"); found != tt.want {
+			t.Errorf("%s: digest() found = %v, want %v", tt.name, found, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	schedulinginformers "k8s.io/client-go/informers/scheduling/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const inventorySyncTimeout = 2 * time.Minute
+
+// clusterInventory caches the workloads, pods, priority classes and nodes of
+// the cluster with shared informers. The listings, the selection and the
+// rollout checks read the local cache, which the watches keep current.
+type clusterInventory struct {
+	deployments     inventoryResource
+	statefulSets    inventoryResource
+	daemonSets      inventoryResource
+	replicaSets     inventoryResource
+	cronJobs        inventoryResource
+	jobs            inventoryResource
+	pods            inventoryResource
+	priorityClasses inventoryResource
+	nodes           inventoryResource
+}
+
+// inventoryResource are the caches of a resource, one for all namespaces or
+// one per namespace of the scope. It is nil when an optional resource could not
+// be cached.
+type inventoryResource []namespacedIndexer
+
+type namespacedIndexer struct {
+	namespace string
+	indexer   cache.Indexer
+}
+
+// listCached lists the cached objects of the namespace, or of all cached
+// namespaces for metav1.NamespaceAll.
+func listCached[T any](resource inventoryResource, namespace string, selector labels.Selector) ([]T, error) {
+	var objects []T
+	for _, cached := range resource {
+		if namespace != metav1.NamespaceAll && cached.namespace != metav1.NamespaceAll && cached.namespace != namespace {
+			continue
+		}
+		err := cache.ListAllByNamespace(cached.indexer, namespace, selector, func(obj interface{}) {
+			objects = append(objects, obj.(T))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// errNotCached is returned for an object which is not in the inventory, e.g.
+// while the watch has not delivered it yet.
+var errNotCached = errors.New("not found in the inventory")
+
+// getCached returns the cached object of the key, the name of a cluster-scoped
+// object or namespace/name.
+func getCached[T any](resource inventoryResource, key string) (T, bool) {
+	var object T
+	for _, cached := range resource {
+		obj, exists, err := cached.indexer.GetByKey(key)
+		if err == nil && exists {
+			return obj.(T), true
+		}
+	}
+	return object, false
+}
+
+// inventoryCache starts the inventory of a cluster on the first use.
+type inventoryCache struct {
+	once      sync.Once
+	inventory *clusterInventory
+	err       error
+}
+
+// currentInventory is the inventory of the cluster in use, see useCluster.
+var currentInventory = &inventoryCache{}
+
+// getInventory starts the informers on the first use and waits until their
+// caches are synced.
+func getInventory() (*clusterInventory, error) {
+	c := currentInventory
+	c.once.Do(func() {
+		c.inventory, c.err = startInventory()
+	})
+	return c.inventory, c.err
+}
+
+// inventoryInformer is an informer of the inventory. The inventory works
+// without the optional informers, e.g. when listing the nodes is forbidden.
+type inventoryInformer struct {
+	resource string
+	informer cache.SharedIndexInformer
+	optional bool
+	// target is the resource of the inventory the informer fills, it is
+	// cleared when an optional informer fails.
+	target *inventoryResource
+
+	stop       chan struct{}
+	failOnce   sync.Once
+	failed     chan struct{}
+	listingErr error
+}
+
+func newInventoryInformer(resource string, informer cache.SharedIndexInformer, optional bool, target *inventoryResource) *inventoryInformer {
+	i := &inventoryInformer{
+		resource: resource,
+		informer: informer,
+		optional: optional,
+		target:   target,
+		stop:     make(chan struct{}),
+		failed:   make(chan struct{}),
+	}
+	_ = informer.SetTransform(stripManagedFields)
+	_ = informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) || apierrors.IsNotFound(err) {
+			i.failOnce.Do(func() {
+				i.listingErr = err
+				close(i.failed)
+			})
+			return
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	return i
+}
+
+// waitForSync waits until the cache is synced, the list is forbidden or the
+// timeout passed. The informer is stopped when it can not sync.
+func (i *inventoryInformer) waitForSync(ctx context.Context) error {
+	err := wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		select {
+		case <-i.failed:
+			return false, i.listingErr
+		default:
+			return i.informer.HasSynced(), nil
+		}
+	})
+	if err == nil {
+		return nil
+	}
+	close(i.stop)
+	if wait.Interrupted(err) {
+		return fmt.Errorf("the %s cache did not sync within %s", i.resource, inventorySyncTimeout)
+	}
+	return fmt.Errorf("list %s: %w", i.resource, err)
+}
+
+func startInventory() (*clusterInventory, error) {
+	// The initial lists are paged from etcd, instead of reading the whole list
+	// from the watch cache of the API server at once.
+	tweak := func(options *metav1.ListOptions) {
+		if !options.Watch && options.ResourceVersion == "0" {
+			options.ResourceVersion = ""
+		}
+	}
+	namespaces := namespaceScope
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	inv := &clusterInventory{}
+	var informers []*inventoryInformer
+	add := func(resource *inventoryResource, name, namespace string, informer cache.SharedIndexInformer, optional bool) {
+		*resource = append(*resource, namespacedIndexer{namespace: namespace, indexer: informer.GetIndexer()})
+		if namespace != metav1.NamespaceAll {
+			name += " in namespace " + namespace
+		}
+		informers = append(informers, newInventoryInformer(name, informer, optional, resource))
+	}
+	namespaceIndexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	for _, ns := range namespaces {
+		add(&inv.deployments, "deployments", ns,
+			appsinformers.NewFilteredDeploymentInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.statefulSets, "statefulsets", ns,
+			appsinformers.NewFilteredStatefulSetInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.daemonSets, "daemonsets", ns,
+			appsinformers.NewFilteredDaemonSetInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.replicaSets, "replicasets", ns,
+			appsinformers.NewFilteredReplicaSetInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.cronJobs, "cronjobs", ns,
+			batchinformers.NewFilteredCronJobInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.jobs, "jobs", ns,
+			batchinformers.NewFilteredJobInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+		add(&inv.pods, "pods", ns,
+			coreinformers.NewFilteredPodInformer(kubeClient, ns, 0, namespaceIndexers, tweak), false)
+	}
+	add(&inv.priorityClasses, "priorityclasses", metav1.NamespaceAll,
+		schedulinginformers.NewFilteredPriorityClassInformer(kubeClient, 0, cache.Indexers{}, tweak), true)
+	add(&inv.nodes, "nodes", metav1.NamespaceAll,
+		coreinformers.NewFilteredNodeInformer(kubeClient, 0, cache.Indexers{}, tweak), true)
+
+	for _, i := range informers {
+		go i.informer.Run(i.stop)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), inventorySyncTimeout)
+	defer cancel()
+	for _, i := range informers {
+		if err := i.waitForSync(ctx); err != nil {
+			if !i.optional {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "Failed to cache %s, continue without them: %v\n", i.resource, err)
+			*i.target = nil
+		}
+	}
+	return inv, nil
+}
+
+// stripManagedFields drops the managed fields of the cached objects, they are
+// not used and take a large part of the memory.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func init() {
+	RegisterWorkloadKind(deploymentHandler{})
+	RegisterWorkloadKind(statefulSetHandler{})
+	RegisterWorkloadKind(daemonSetHandler{})
+	RegisterWorkloadKind(replicaSetHandler{})
+}
+
+type deploymentHandler struct{}
+
+func (deploymentHandler) Kind() WorkloadKind { return WorkloadDeployment }
+
+func (deploymentHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*appsv1.Deployment](inv.deployments, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		objects = append(objects, &deploymentObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (deploymentHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	deployment, err := kubeClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &deploymentObject{deployment}, nil
+}
+
+func (deploymentHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*appsv1.Deployment](inv.deployments, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &deploymentObject{item.DeepCopy()}, nil
+}
+
+func (deploymentHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.AppsV1().Deployments(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+type deploymentObject struct {
+	*appsv1.Deployment
+}
+
+func (o *deploymentObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	return &o.Spec.Template, nil
+}
+
+func (o *deploymentObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	o.Spec.Template = *template
+	return nil
+}
+
+func (o *deploymentObject) Selector() *metav1.LabelSelector { return o.Spec.Selector }
+
+func (o *deploymentObject) Replicas() int32 { return *o.Spec.Replicas }
+
+func (o *deploymentObject) AvailableReplicas() int32 { return o.Status.AvailableReplicas }
+
+func (o *deploymentObject) Ready() bool { return CheckDeploymentIsReady(o.Deployment) }
+
+func (o *deploymentObject) DeepCopyWorkload() WorkloadObject { return &deploymentObject{o.DeepCopy()} }
+
+// RevisionPodSelector selects the pods of the ReplicaSet of the current
+// revision of the Deployment, by its pod-template-hash.
+func (o *deploymentObject) RevisionPodSelector(context.Context) (labels.Selector, bool, error) {
+	revision := o.Annotations[deploymentRevisionAnnotation]
+	if o.Status.ObservedGeneration != o.Generation || revision == "" {
+		return nil, false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(o.Spec.Selector)
+	if err != nil {
+		return nil, false, err
+	}
+	replicaSets, err := o.replicaSets()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, rs := range replicaSets {
+		if rs.Annotations[deploymentRevisionAnnotation] == revision {
+			return withLabel(selector, appsv1.DefaultDeploymentUniqueLabelKey, rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey])
+		}
+	}
+	return nil, false, nil
+}
+
+// PodOwners returns the ReplicaSets of the Deployment, they control its pods.
+func (o *deploymentObject) PodOwners(context.Context) ([]types.UID, error) {
+	replicaSets, err := o.replicaSets()
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]types.UID, 0, len(replicaSets))
+	for _, rs := range replicaSets {
+		uids = append(uids, rs.UID)
+	}
+	return uids, nil
+}
+
+// replicaSets returns the ReplicaSets controlled by the Deployment.
+func (o *deploymentObject) replicaSets() ([]*appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(o.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return controlledReplicaSets(o.Namespace, selector, o.UID)
+}
+
+// controlledReplicaSets returns the ReplicaSets of the namespace matching the
+// selector which are controlled by the owner.
+func controlledReplicaSets(namespace string, selector labels.Selector, owner types.UID) ([]*appsv1.ReplicaSet, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*appsv1.ReplicaSet](inv.replicaSets, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	var replicaSets []*appsv1.ReplicaSet
+	for _, rs := range list {
+		if controller := metav1.GetControllerOf(rs); controller != nil && controller.UID == owner {
+			replicaSets = append(replicaSets, rs)
+		}
+	}
+	return replicaSets, nil
+}
+
+type statefulSetHandler struct{}
+
+func (statefulSetHandler) Kind() WorkloadKind { return WorkloadStatefulSet }
+
+func (statefulSetHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*appsv1.StatefulSet](inv.statefulSets, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		objects = append(objects, &statefulSetObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (statefulSetHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	sts, err := kubeClient.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &statefulSetObject{sts}, nil
+}
+
+func (statefulSetHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*appsv1.StatefulSet](inv.statefulSets, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &statefulSetObject{item.DeepCopy()}, nil
+}
+
+func (statefulSetHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+type statefulSetObject struct {
+	*appsv1.StatefulSet
+}
+
+func (o *statefulSetObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	return &o.Spec.Template, nil
+}
+
+func (o *statefulSetObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	o.Spec.Template = *template
+	return nil
+}
+
+func (o *statefulSetObject) Selector() *metav1.LabelSelector { return o.Spec.Selector }
+
+func (o *statefulSetObject) Replicas() int32 { return *o.Spec.Replicas }
+
+func (o *statefulSetObject) AvailableReplicas() int32 { return o.Status.ReadyReplicas }
+
+func (o *statefulSetObject) Ready() bool { return CheckStatefulSetIsReady(o.StatefulSet) }
+
+// RolloutNote explains why the rollout of the OnDelete strategy is not waited
+// for.
+func (o *statefulSetObject) RolloutNote() string {
+	if o.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return "the OnDelete update strategy only replaces the pods when they are deleted"
+	}
+	return ""
+}
+
+func (o *statefulSetObject) DeepCopyWorkload() WorkloadObject {
+	return &statefulSetObject{o.DeepCopy()}
+}
+
+// RevisionPodSelector selects the pods of the update revision of the
+// StatefulSet.
+func (o *statefulSetObject) RevisionPodSelector(context.Context) (labels.Selector, bool, error) {
+	if o.Status.ObservedGeneration != o.Generation || o.Status.UpdateRevision == "" {
+		return nil, false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(o.Spec.Selector)
+	if err != nil {
+		return nil, false, err
+	}
+	return withLabel(selector, appsv1.ControllerRevisionHashLabelKey, o.Status.UpdateRevision)
+}
+
+type daemonSetHandler struct{}
+
+func (daemonSetHandler) Kind() WorkloadKind { return WorkloadDaemonSet }
+
+func (daemonSetHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*appsv1.DaemonSet](inv.daemonSets, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		objects = append(objects, &daemonSetObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (daemonSetHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	ds, err := kubeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &daemonSetObject{ds}, nil
+}
+
+func (daemonSetHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*appsv1.DaemonSet](inv.daemonSets, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &daemonSetObject{item.DeepCopy()}, nil
+}
+
+func (daemonSetHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+type daemonSetObject struct {
+	*appsv1.DaemonSet
+}
+
+func (o *daemonSetObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	return &o.Spec.Template, nil
+}
+
+func (o *daemonSetObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	o.Spec.Template = *template
+	return nil
+}
+
+func (o *daemonSetObject) Selector() *metav1.LabelSelector { return o.Spec.Selector }
+
+func (o *daemonSetObject) Replicas() int32 { return o.Status.DesiredNumberScheduled }
+
+func (o *daemonSetObject) AvailableReplicas() int32 { return o.Status.NumberAvailable }
+
+func (o *daemonSetObject) Ready() bool { return CheckDaemonSetIsReady(o.DaemonSet) }
+
+func (o *daemonSetObject) DeepCopyWorkload() WorkloadObject { return &daemonSetObject{o.DeepCopy()} }
+
+// RevisionPodSelector selects the pods created from the current template
+// generation of the DaemonSet. The API server increments the template
+// generation, kept in an annotation by apps/v1, with every template change and
+// the controller labels the pods with it.
+func (o *daemonSetObject) RevisionPodSelector(context.Context) (labels.Selector, bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(o.Spec.Selector)
+	if err != nil {
+		return nil, false, err
+	}
+	return withLabel(selector, daemonSetTemplateGenerationKey, o.Annotations[appsv1.DeprecatedTemplateGeneration])
+}
+
+type replicaSetHandler struct{}
+
+func (replicaSetHandler) Kind() WorkloadKind { return WorkloadReplicaSet }
+
+func (replicaSetHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*appsv1.ReplicaSet](inv.replicaSets, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		// ReplicaSets controlled by a Deployment are handled through the Deployment
+		if metav1.GetControllerOf(item) != nil {
+			continue
+		}
+		objects = append(objects, &replicaSetObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (replicaSetHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	rs, err := kubeClient.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &replicaSetObject{rs}, nil
+}
+
+func (replicaSetHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*appsv1.ReplicaSet](inv.replicaSets, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &replicaSetObject{item.DeepCopy()}, nil
+}
+
+func (replicaSetHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.AppsV1().ReplicaSets(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+func (replicaSetHandler) RolloutNote() string {
+	return "ReplicaSet does not replace its running pods, only new pods get the change"
+}
+
+type replicaSetObject struct {
+	*appsv1.ReplicaSet
+}
+
+func (o *replicaSetObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	return &o.Spec.Template, nil
+}
+
+func (o *replicaSetObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	o.Spec.Template = *template
+	return nil
+}
+
+func (o *replicaSetObject) Selector() *metav1.LabelSelector { return o.Spec.Selector }
+
+func (o *replicaSetObject) Replicas() int32 { return *o.Spec.Replicas }
+
+func (o *replicaSetObject) AvailableReplicas() int32 { return o.Status.AvailableReplicas }
+
+func (o *replicaSetObject) Ready() bool { return CheckReplicaSetIsReady(o.ReplicaSet) }
+
+func (o *replicaSetObject) DeepCopyWorkload() WorkloadObject { return &replicaSetObject{o.DeepCopy()} }
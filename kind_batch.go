@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func init() {
+	RegisterWorkloadKind(cronJobHandler{})
+	RegisterWorkloadKind(jobHandler{})
+}
+
+type cronJobHandler struct{}
+
+func (cronJobHandler) Kind() WorkloadKind { return WorkloadCronJob }
+
+func (cronJobHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*batchv1.CronJob](inv.cronJobs, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		objects = append(objects, &cronJobObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (cronJobHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	cj, err := kubeClient.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &cronJobObject{cj}, nil
+}
+
+func (cronJobHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*batchv1.CronJob](inv.cronJobs, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &cronJobObject{item.DeepCopy()}, nil
+}
+
+func (cronJobHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.BatchV1().CronJobs(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+func (cronJobHandler) RolloutNote() string {
+	return "CronJob does not change its running jobs, the next scheduled run gets the change"
+}
+
+type cronJobObject struct {
+	*batchv1.CronJob
+}
+
+func (o *cronJobObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	return &o.Spec.JobTemplate.Spec.Template, nil
+}
+
+func (o *cronJobObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	o.Spec.JobTemplate.Spec.Template = *template
+	return nil
+}
+
+func (o *cronJobObject) Selector() *metav1.LabelSelector { return o.Spec.JobTemplate.Spec.Selector }
+
+func (o *cronJobObject) Replicas() int32 { return jobParallelism(&o.Spec.JobTemplate.Spec) }
+
+func (o *cronJobObject) AvailableReplicas() int32 { return int32(len(o.Status.Active)) }
+
+func (o *cronJobObject) Ready() bool { return CheckCronJobIsReady(o.CronJob) }
+
+func (o *cronJobObject) DeepCopyWorkload() WorkloadObject { return &cronJobObject{o.DeepCopy()} }
+
+func (o *cronJobObject) LastScheduleTime() *metav1.Time { return o.Status.LastScheduleTime }
+
+func (o *cronJobObject) LastSuccessfulTime() *metav1.Time { return o.Status.LastSuccessfulTime }
+
+// PodOwners returns the Jobs created by the CronJob, they control its pods.
+func (o *cronJobObject) PodOwners(context.Context) ([]types.UID, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := listCached[*batchv1.Job](inv.jobs, o.Namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var uids []types.UID
+	for _, job := range jobs {
+		if owner := metav1.GetControllerOf(job); owner != nil && owner.UID == o.UID {
+			uids = append(uids, job.UID)
+		}
+	}
+	return uids, nil
+}
+
+type jobHandler struct{}
+
+func (jobHandler) Kind() WorkloadKind { return WorkloadJob }
+
+func (jobHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*batchv1.Job](inv.jobs, namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list))
+	for _, item := range list {
+		// Jobs created by a CronJob are handled through the CronJob
+		if metav1.GetControllerOf(item) != nil {
+			continue
+		}
+		objects = append(objects, &jobObject{item.DeepCopy()})
+	}
+	return objects, nil
+}
+
+func (jobHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	job, err := kubeClient.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &jobObject{job}, nil
+}
+
+func (jobHandler) GetCached(namespace, name string) (WorkloadObject, error) {
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := getCached[*batchv1.Job](inv.jobs, namespace+"/"+name)
+	if !ok {
+		return nil, errNotCached
+	}
+	return &jobObject{item.DeepCopy()}, nil
+}
+
+func (jobHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := kubeClient.BatchV1().Jobs(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+type jobObject struct {
+	*batchv1.Job
+}
+
+func (o *jobObject) PodTemplate() (*corev1.PodTemplateSpec, error) { return &o.Spec.Template, nil }
+
+func (o *jobObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	return ErrJobTemplateImmutable
+}
+
+func (o *jobObject) Selector() *metav1.LabelSelector { return o.Spec.Selector }
+
+func (o *jobObject) Replicas() int32 { return jobParallelism(&o.Spec) }
+
+func (o *jobObject) AvailableReplicas() int32 { return o.Status.Active }
+
+func (o *jobObject) Ready() bool { return CheckJobIsReady(o.Job) }
+
+func (o *jobObject) DeepCopyWorkload() WorkloadObject { return &jobObject{o.DeepCopy()} }
+
+func jobParallelism(spec *batchv1.JobSpec) int32 {
+	if spec.Parallelism == nil {
+		return 1
+	}
+	return *spec.Parallelism
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// registerCustomWorkloads registers a handler backed by the dynamic client for
+// every custom workload of the config.
+func registerCustomWorkloads(configs []CustomWorkloadConfig) error {
+	for _, config := range configs {
+		handler, err := newCustomWorkloadHandler(config)
+		if err != nil {
+			return err
+		}
+		if _, exists := workloadKindHandlers[handler.Kind()]; exists {
+			return fmt.Errorf("custom workload kind %s is already registered", handler.Kind())
+		}
+		RegisterWorkloadKind(handler)
+	}
+	return nil
+}
+
+type customWorkloadHandler struct {
+	kind WorkloadKind
+	gvr  schema.GroupVersionResource
+
+	podTemplatePath        []string
+	selectorPath           []string
+	replicasPath           []string
+	readyReplicasPath      []string
+	availableReplicasPath  []string
+	observedGenerationPath []string
+	updatedReplicasPath    []string
+}
+
+func newCustomWorkloadHandler(config CustomWorkloadConfig) (*customWorkloadHandler, error) {
+	if config.Kind == "" || config.Version == "" || config.Resource == "" {
+		return nil, fmt.Errorf("custom workload %+v requires kind, version and resource", config)
+	}
+
+	return &customWorkloadHandler{
+		kind:                   WorkloadKind(config.Kind),
+		gvr:                    schema.GroupVersionResource{Group: config.Group, Version: config.Version, Resource: config.Resource},
+		podTemplatePath:        parseFieldPath(config.PodTemplatePath, "spec.template"),
+		selectorPath:           parseFieldPath(config.SelectorPath, "spec.selector"),
+		replicasPath:           parseFieldPath(config.ReplicasPath, "spec.replicas"),
+		readyReplicasPath:      parseFieldPath(config.ReadyReplicasPath, "status.readyReplicas"),
+		availableReplicasPath:  parseFieldPath(config.AvailableReplicasPath, "status.availableReplicas"),
+		observedGenerationPath: parseFieldPath(config.ObservedGenerationPath, "status.observedGeneration"),
+		updatedReplicasPath:    parseFieldPath(config.UpdatedReplicasPath, "status.updatedReplicas"),
+	}, nil
+}
+
+// parseFieldPath accepts `spec.template`, `.spec.template` and `{.spec.template}`.
+func parseFieldPath(path, defaultPath string) []string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		path = defaultPath
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	return strings.Split(strings.TrimPrefix(path, "."), ".")
+}
+
+func (h *customWorkloadHandler) Kind() WorkloadKind { return h.kind }
+
+func (h *customWorkloadHandler) List(ctx context.Context, namespace string) ([]WorkloadObject, error) {
+	list, err := dynamicClient.Resource(h.gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "Skip custom workload kind %s, %s is not served by the cluster\n", h.kind, h.gvr)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]WorkloadObject, 0, len(list.Items))
+	for i := range list.Items {
+		objects = append(objects, &customWorkloadObject{Unstructured: &list.Items[i], handler: h})
+	}
+	return objects, nil
+}
+
+func (h *customWorkloadHandler) Get(ctx context.Context, namespace, name string) (WorkloadObject, error) {
+	obj, err := dynamicClient.Resource(h.gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &customWorkloadObject{Unstructured: obj, handler: h}, nil
+}
+
+func (h *customWorkloadHandler) Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error {
+	_, err := dynamicClient.Resource(h.gvr).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+	return err
+}
+
+type customWorkloadObject struct {
+	*unstructured.Unstructured
+	handler *customWorkloadHandler
+}
+
+func (o *customWorkloadObject) PodTemplate() (*corev1.PodTemplateSpec, error) {
+	raw, found, err := unstructured.NestedMap(o.Object, o.handler.podTemplatePath...)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("pod template %s not found", strings.Join(o.handler.podTemplatePath, "."))
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, template); err != nil {
+		return nil, fmt.Errorf("convert pod template: %w", err)
+	}
+	return template, nil
+}
+
+// SetPodTemplate only writes the changed fields back to the object, so that
+// the fields unknown to corev1.PodTemplateSpec and the zero values dropped by
+// the conversion are kept as they are.
+func (o *customWorkloadObject) SetPodTemplate(template *corev1.PodTemplateSpec) error {
+	original, err := o.PodTemplate()
+	if err != nil {
+		return err
+	}
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	updatedJSON, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.CreateMergePatch(originalJSON, updatedJSON)
+	if err != nil {
+		return err
+	}
+
+	raw, _, err := unstructured.NestedMap(o.Object, o.handler.podTemplatePath...)
+	if err != nil {
+		return err
+	}
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	mergedJSON, err := jsonpatch.MergePatch(rawJSON, patch)
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]interface{})
+	if err := json.Unmarshal(mergedJSON, &merged); err != nil {
+		return err
+	}
+	return unstructured.SetNestedMap(o.Object, merged, o.handler.podTemplatePath...)
+}
+
+func (o *customWorkloadObject) Selector() *metav1.LabelSelector {
+	raw, found, err := unstructured.NestedMap(o.Object, o.handler.selectorPath...)
+	if err != nil || !found {
+		return nil
+	}
+	selector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, selector); err != nil {
+		return nil
+	}
+	return selector
+}
+
+func (o *customWorkloadObject) Replicas() int32 {
+	replicas, found := o.nestedNumber(o.handler.replicasPath)
+	if !found {
+		return 1
+	}
+	return int32(replicas)
+}
+
+func (o *customWorkloadObject) AvailableReplicas() int32 {
+	available, found := o.nestedNumber(o.handler.availableReplicasPath)
+	if !found {
+		return o.readyReplicas()
+	}
+	return int32(available)
+}
+
+func (o *customWorkloadObject) readyReplicas() int32 {
+	ready, _ := o.nestedNumber(o.handler.readyReplicasPath)
+	return int32(ready)
+}
+
+func (o *customWorkloadObject) Ready() bool {
+	observed, found := o.nestedNumber(o.handler.observedGenerationPath)
+	if found && observed != o.GetGeneration() {
+		return false
+	}
+	// Kinds without updated replicas are ready by their ready replicas.
+	if updated, found := o.nestedNumber(o.handler.updatedReplicasPath); found && int32(updated) != o.Replicas() {
+		return false
+	}
+	return o.readyReplicas() >= o.Replicas()
+}
+
+// PodOwners returns the ReplicaSets controlled by the workload, e.g. the pods
+// of an Argo Rollout are controlled by its ReplicaSets.
+func (o *customWorkloadObject) PodOwners(context.Context) ([]types.UID, error) {
+	selector := labels.Everything()
+	if o.Selector() != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(o.Selector()); err != nil {
+			return nil, err
+		}
+	}
+	replicaSets, err := controlledReplicaSets(o.GetNamespace(), selector, o.GetUID())
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]types.UID, 0, len(replicaSets))
+	for _, rs := range replicaSets {
+		uids = append(uids, rs.UID)
+	}
+	return uids, nil
+}
+
+// nestedNumber reads an integer field, the numbers of objects decoded by
+// encoding/json are float64 instead of int64.
+func (o *customWorkloadObject) nestedNumber(path []string) (int64, bool) {
+	value, found, err := unstructured.NestedNumberAsFloat64(o.Object, path...)
+	if err != nil || !found {
+		return 0, false
+	}
+	return int64(value), true
+}
+
+func (o *customWorkloadObject) DeepCopyWorkload() WorkloadObject {
+	return &customWorkloadObject{Unstructured: o.DeepCopy(), handler: o.handler}
+}
@@ -3,26 +3,140 @@ package main
 import (
 	"flag"
 	"fmt"
+	"slices"
+	"strings"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func loadKubeClient() (*kubernetes.Clientset, error) {
-	kubeconfig := flag.String("kubeconfig", "", "specified the path to the kubeconfig file")
-	flag.Parse()
-	if *kubeconfig == "" {
-		return nil, fmt.Errorf("--kubeconfig is required")
+type kubeOptions struct {
+	kubeconfig string
+	context    string
+	// contexts are the clusters of the fleet mode.
+	contexts []string
+	as       string
+	asGroups []string
+	qps      float64
+	burst    int
+	// namespaces scope the listing and patching to these namespaces, all
+	// namespaces are used when it is empty.
+	namespaces []string
+}
+
+// namespaceScope are the namespaces the workloads are listed from, empty for
+// the whole cluster.
+var namespaceScope []string
+
+func (o *kubeOptions) addFlags(fs *flag.FlagSet) {
+	o.qps, o.burst = 5, 10
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "",
+		"path to the kubeconfig file, defaults to $KUBECONFIG, ~/.kube/config or the in-cluster config")
+	fs.StringVar(&o.context, "context", "", "kubeconfig context to use, defaults to the current context")
+	fs.Func("contexts", "comma separated kubeconfig contexts of the clusters to work on at once, e.g. prod-eu,prod-us",
+		func(value string) error {
+			o.useContexts(parseCommaList(value))
+			return nil
+		})
+	fs.StringVar(&o.as, "as", "", "user to impersonate for the operations")
+	fs.Func("as-group", "group to impersonate for the operations, can be repeated", func(value string) error {
+		o.asGroups = append(o.asGroups, value)
+		return nil
+	})
+	fs.Float64Var(&o.qps, "qps", o.qps, "maximum queries per second to the kubernetes API server")
+	fs.IntVar(&o.burst, "burst", o.burst, "maximum burst of queries to the kubernetes API server")
+}
+
+// scopeNamespaces limits the listing to the namespaces, e.g. for teams without
+// cluster-wide permissions.
+func (o *kubeOptions) scopeNamespaces(namespaces []string) {
+	for _, namespace := range namespaces {
+		if !slices.Contains(o.namespaces, namespace) {
+			o.namespaces = append(o.namespaces, namespace)
+		}
+	}
+	slices.Sort(o.namespaces)
+}
+
+// useContexts adds the contexts to the fleet.
+func (o *kubeOptions) useContexts(contexts []string) {
+	for _, context := range contexts {
+		if context != "" && !slices.Contains(o.contexts, context) {
+			o.contexts = append(o.contexts, context)
+		}
+	}
+}
+
+// initKubeClients creates the typed and the dynamic kubernetes clients. The
+// kubeconfig is loaded like kubectl does: --kubeconfig, $KUBECONFIG,
+// ~/.kube/config and the in-cluster config of a pod. With --contexts the
+// clients of every context are created, see useCluster.
+func initKubeClients(o *kubeOptions) error {
+	if len(o.asGroups) > 0 && o.as == "" {
+		return fmt.Errorf("--as-group requires --as")
 	}
+	if len(o.contexts) > 0 && o.context != "" {
+		return fmt.Errorf("--context and --contexts can not be used together")
+	}
+	namespaceScope = o.namespaces
+
+	if len(o.contexts) == 0 {
+		var err error
+		kubeClient, dynamicClient, err = newKubeClients(o, o.context)
+		return err
+	}
+	for _, context := range o.contexts {
+		kube, dynamic, err := newKubeClients(o, context)
+		if err != nil {
+			return fmt.Errorf("context %s: %w", context, err)
+		}
+		fleet = append(fleet, &fleetCluster{
+			name:          context,
+			kubeClient:    kube,
+			dynamicClient: dynamic,
+			inventory:     &inventoryCache{},
+			pullSecrets:   newPullSecrets(),
+		})
+	}
+	return useCluster(o.contexts[0])
+}
+
+func newKubeClients(o *kubeOptions, context string) (*kubernetes.Clientset, dynamic.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	overrides.AuthInfo.Impersonate = o.as
+	overrides.AuthInfo.ImpersonateGroups = o.asGroups
 
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 	if err != nil {
-		return nil, err
+		if clientcmd.IsEmptyConfig(err) {
+			return nil, nil, fmt.Errorf("no kubeconfig found, use --kubeconfig or $KUBECONFIG")
+		}
+		return nil, nil, err
 	}
+	config.QPS = float32(o.qps)
+	config.Burst = o.burst
 
-	client, err := kubernetes.NewForConfig(config)
+	kube, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	dynamic, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kube, dynamic, nil
+}
+
+// parseCommaList parses a comma separated list, e.g. of namespaces.
+func parseCommaList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
 	}
-	return client, nil
+	return values
 }
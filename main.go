@@ -2,26 +2,42 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
 var kubeClient *kubernetes.Clientset
 
+var dynamicClient dynamic.Interface
+
 var workloads []Workload
 
 func main() {
-	var err error
-	kubeClient, err = loadKubeClient()
-	if err != nil {
-		log.Fatalf("Failed to create kubernetes client, err: %v", err)
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+func runInteractive(args []string) error {
+	fs := flag.NewFlagSet("interactive", flag.ContinueOnError)
+	opts := &globalOptions{}
+	opts.addFlags(fs)
+	addDryRunFlag(fs)
+	addRolloutWaitFlags(fs)
+	namespaces := fs.String("namespace", "", "comma separated namespaces the workloads are listed from, defaults to all namespaces")
+	if err := fs.Parse(args); err != nil {
+		return newUsageError(err)
+	}
+	opts.kube.scopeNamespaces(parseCommaList(*namespaces))
+	if err := opts.init(); err != nil {
+		return err
 	}
 
 	if err := printWorkloadsTable(""); err != nil {
-		log.Fatalf("Failed to print workloads table, err: %v", err)
+		return fmt.Errorf("failed to print workloads table, err: %w", err)
 	}
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -36,7 +52,10 @@ func main() {
 		fmt.Print("Input the action number: ")
 
 		if !scanner.Scan() {
-			continue
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return nil
 		}
 		choice := scanner.Text()
 
@@ -52,27 +71,33 @@ func main() {
 			if err != nil {
 				log.Printf("Failed to select workloads, err: %v\n", err)
 			}
-			migrateWorkload(selectedWorkloads)
+			reportActionResult(migrateWorkload(selectedWorkloads))
 		case "3":
 			selectedWorkloads, err := selectWorkloads(scanner)
 			if err != nil {
 				log.Printf("Failed to select workloads, err: %v\n", err)
 			}
-			rollbackWorkload(selectedWorkloads)
+			reportActionResult(rollbackWorkload(selectedWorkloads))
 		case "4":
 			selectedWorkloads, err := selectWorkloads(scanner)
 			if err != nil {
 				log.Printf("Failed to select workloads, err: %v\n", err)
 			}
-			patchWorkloadARMAffinity(selectedWorkloads)
+			reportActionResult(patchWorkloadARMAffinity(selectedWorkloads))
 		case "5":
 			selectedWorkloads, err := selectWorkloads(scanner)
 			if err != nil {
 				log.Printf("Failed to select workloads, err: %v\n", err)
 			}
-			rollbackWorkloadARMAffinity(selectedWorkloads)
+			reportActionResult(rollbackWorkloadARMAffinity(selectedWorkloads))
 		case "6":
-			return
+			return nil
 		}
 	}
 }
+
+func reportActionResult(err error) {
+	if err != nil {
+		log.Printf("%v\n", err)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// OutputFormat is the format of the workload list printed by list and arm-check.
+type OutputFormat string
+
+const (
+	OutputTable    OutputFormat = "table"
+	OutputWide     OutputFormat = "wide"
+	OutputJSON     OutputFormat = "json"
+	OutputYAML     OutputFormat = "yaml"
+	OutputCSV      OutputFormat = "csv"
+	OutputMarkdown OutputFormat = "markdown"
+)
+
+var outputFormats = []OutputFormat{OutputTable, OutputWide, OutputJSON, OutputYAML, OutputCSV, OutputMarkdown}
+
+func (f *OutputFormat) String() string { return string(*f) }
+
+func (f *OutputFormat) Set(value string) error {
+	if !slices.Contains(outputFormats, OutputFormat(value)) {
+		return fmt.Errorf("invalid output format %q, must be one of table, wide, json, yaml, csv or markdown", value)
+	}
+	*f = OutputFormat(value)
+	return nil
+}
+
+// machineReadable reports whether the output is meant for other programs, the
+// messages are printed to stderr then.
+func (f OutputFormat) machineReadable() bool {
+	return f != OutputTable && f != OutputWide
+}
+
+func addOutputFlag(fs *flag.FlagSet) *OutputFormat {
+	format := OutputTable
+	usage := "output format, one of table, wide, json, yaml, csv or markdown"
+	fs.Var(&format, "o", usage)
+	fs.Var(&format, "output", usage)
+	return &format
+}
+
+// WorkloadList is the machine readable workload list. The JSON and YAML output
+// can be passed back with --from to select the same workloads.
+type WorkloadList struct {
+	Items []WorkloadRecord `json:"items"`
+}
+
+// WorkloadRecord is a workload of the machine readable output.
+type WorkloadRecord struct {
+	ID             int               `json:"id"`
+	Cluster        string            `json:"cluster,omitempty"`
+	Namespace      string            `json:"namespace"`
+	Kind           WorkloadKind      `json:"kind"`
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Replicas       int32             `json:"replicas"`
+	Available      int32             `json:"available"`
+	Ready          bool              `json:"ready"`
+	MigratePatched bool              `json:"migratePatched"`
+	// ARMSupported is not set when the ARM check failed, see ARMError.
+	ARMSupported *bool  `json:"armSupported"`
+	ARMError     string `json:"armError,omitempty"`
+	ARMPatched   bool   `json:"armPatched"`
+	// Priority is not set when the priority classes could not be read.
+	Priority           *int32       `json:"priority"`
+	PodPriorities      []int32      `json:"podPriorities,omitempty"`
+	LastScheduleTime   *metav1.Time `json:"lastScheduleTime,omitempty"`
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// Pods are the pods of the workload with their readiness and node.
+	Pods []WorkloadPod `json:"pods,omitempty"`
+	// Containers are the ARM check results of the containers.
+	Containers []ContainerRecord `json:"containers,omitempty"`
+}
+
+// ContainerRecord is the ARM check result of a container in the machine
+// readable output.
+type ContainerRecord struct {
+	Name         string          `json:"name"`
+	Type         ContainerType   `json:"type"`
+	Image        string          `json:"image"`
+	Digest       string          `json:"digest,omitempty"`
+	Platforms    []ImagePlatform `json:"platforms,omitempty"`
+	ARMSupported *bool           `json:"armSupported"`
+	ARMReason    string          `json:"armReason,omitempty"`
+	ARMError     string          `json:"armError,omitempty"`
+}
+
+func newWorkloadRecord(id int, w Workload, arm ArmResult) WorkloadRecord {
+	record := WorkloadRecord{
+		ID:                 id,
+		Cluster:            w.Cluster,
+		Namespace:          w.Namespace,
+		Kind:               w.Kind,
+		Name:               w.Name,
+		Labels:             w.Labels,
+		Replicas:           w.Replicas,
+		Available:          w.Available,
+		Ready:              w.Ready,
+		MigratePatched:     w.MigratePatched,
+		ARMError:           formatARMError(arm),
+		ARMPatched:         w.ARMPatched,
+		PodPriorities:      w.PodPriorities,
+		LastScheduleTime:   w.LastScheduleTime,
+		LastSuccessfulTime: w.LastSuccessfulTime,
+		Pods:               w.Pods,
+	}
+	if arm.Err == nil {
+		record.ARMSupported = &arm.Supported
+	}
+	if !w.PriorityUnknown {
+		record.Priority = &w.Priority
+	}
+	for _, c := range arm.Containers {
+		container := ContainerRecord{Name: c.Name, Type: c.Type, Image: c.Image, Digest: c.Digest,
+			Platforms: c.Platforms, ARMReason: c.Reason}
+		if c.Err != nil {
+			container.ARMError = c.Err.Error()
+		} else {
+			container.ARMSupported = &c.Supported
+		}
+		record.Containers = append(record.Containers, container)
+	}
+	return record
+}
+
+// printArmDetails prints the ARM check result of every container of the
+// workloads.
+func printArmDetails(selectedWorkloads []Workload, armResults []ArmResult) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(insertClusterColumn(table.Row{"Namespace", "Kind", "Name", "Container", "Type", "Image", "Digest",
+		"Platforms", "ARM64"}, 0, "Cluster"))
+
+	for id, w := range selectedWorkloads {
+		for _, c := range armResults[id].Containers {
+			arm64 := text.Colors{text.FgGreen}.Sprint("True")
+			switch {
+			case c.Err != nil:
+				arm64 = text.Colors{text.FgRed}.Sprintf("Unknown: %v", c.Err)
+			case !c.Supported:
+				arm64 = text.Colors{text.FgRed}.Sprintf("False: %s", c.Reason)
+			}
+			platforms := make([]string, 0, len(c.Platforms))
+			for _, platform := range c.Platforms {
+				platforms = append(platforms, platform.String())
+			}
+			t.AppendRow(insertClusterColumn(table.Row{w.Namespace, w.Kind, w.Name, c.Name, c.Type, c.Image, c.Digest,
+				strings.Join(platforms, "\n"), arm64}, 0, w.Cluster))
+		}
+	}
+
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Cluster", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Namespace", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Kind", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Name", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+	})
+	t.Style().Options.SeparateRows = true
+	t.Render()
+}
+
+func formatARMError(arm ArmResult) string {
+	if arm.Err == nil {
+		return ""
+	}
+	return arm.Err.Error()
+}
+
+// printWorkloads prints the workloads and their ARM check results in the format.
+func printWorkloads(selectedWorkloads []Workload, armResults []ArmResult, format OutputFormat) error {
+	switch format {
+	case OutputTable, OutputWide:
+		renderWorkloadsTable(selectedWorkloads, armResults, "", format == OutputWide)
+		return nil
+	}
+
+	list := WorkloadList{Items: make([]WorkloadRecord, 0, len(selectedWorkloads))}
+	for id, w := range selectedWorkloads {
+		list.Items = append(list.Items, newWorkloadRecord(id, w, armResults[id]))
+	}
+
+	switch format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case OutputYAML:
+		data, err := yaml.Marshal(list)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case OutputCSV, OutputMarkdown:
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(insertClusterColumn(table.Row{"ID", "Namespace", "Kind", "Name", "Replicas", "Available", "Ready",
+			"MigratePatched", "ARMSupported", "BlockedBy", "ARMError", "ARMPatched", "Priority", "LastRun", "Pods", "Nodes",
+			"Labels"}, 1, "Cluster"))
+		for _, record := range list.Items {
+			w := selectedWorkloads[record.ID]
+			armSupported := "Unknown"
+			if record.ARMSupported != nil {
+				armSupported = fmt.Sprint(*record.ARMSupported)
+			}
+			blockedBy := strings.Join(armResults[record.ID].BlockedBy(), " ")
+			lastRun := text.StripEscape(formatLastRun(w))
+			t.AppendRow(insertClusterColumn(table.Row{record.ID, record.Namespace, record.Kind, record.Name,
+				record.Replicas, record.Available, record.Ready, record.MigratePatched, armSupported, blockedBy,
+				record.ARMError, record.ARMPatched, formatPriority(w), lastRun, formatPodReadiness(record.Pods),
+				formatNodePlacement(record.Pods), labels.FormatLabels(record.Labels)}, 1, record.Cluster))
+		}
+		if format == OutputCSV {
+			t.RenderCSV()
+		} else {
+			t.RenderMarkdown()
+		}
+	}
+	return nil
+}
+
+// readWorkloadList reads the JSON or YAML output of list or arm-check, either
+// the list object or a plain array of its items, from the file or stdin for "-".
+func readWorkloadList(path string) ([]WorkloadRecord, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read workload list: %w", err)
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse workload list %s: %w", path, err)
+	}
+	if trimmed := bytes.TrimSpace(jsonData); len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []WorkloadRecord
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("parse workload list %s: %w", path, err)
+		}
+		return items, nil
+	}
+	list := WorkloadList{}
+	if err := json.Unmarshal(jsonData, &list); err != nil {
+		return nil, fmt.Errorf("parse workload list %s: %w", path, err)
+	}
+	return list.Items, nil
+}
+
+// selectListedWorkloads keeps the workloads contained in the list, in their
+// current order.
+func selectListedWorkloads(candidates []Workload, items []WorkloadRecord) []Workload {
+	listed := make(map[string]bool, len(items))
+	for _, item := range items {
+		listed[workloadKey(item.Cluster, item.Kind, item.Namespace, item.Name)] = true
+	}
+
+	var selected []Workload
+	for _, w := range candidates {
+		if listed[workloadKey(w.Cluster, w.Kind, w.Namespace, w.Name)] {
+			selected = append(selected, w)
+		}
+	}
+	if len(selected) < len(listed) {
+		fmt.Fprintf(os.Stderr, "%d workloads of the list were not found\n", len(listed)-len(selected))
+	}
+	return selected
+}
+
+// messageOutput returns where the messages which accompany the output go.
+func messageOutput(format OutputFormat) io.Writer {
+	if format.machineReadable() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
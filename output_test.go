@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectListedWorkloads(t *testing.T) {
+	candidates := []Workload{
+		{Kind: WorkloadDeployment, Namespace: "default", Name: "api"},
+		{Kind: WorkloadStatefulSet, Namespace: "default", Name: "api"},
+		{Kind: WorkloadDeployment, Namespace: "payments", Name: "api"},
+		{Kind: WorkloadDeployment, Namespace: "payments", Name: "worker"},
+	}
+	listed, err := json.Marshal(WorkloadList{Items: []WorkloadRecord{
+		newWorkloadRecord(0, candidates[0], ArmResult{Supported: true}),
+		newWorkloadRecord(3, candidates[3], ArmResult{}),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		list string
+		want []string
+	}{
+		{name: "printed list", list: string(listed), want: []string{"Deployment default/api", "Deployment payments/worker"}},
+		{name: "plain array", list: `[{"kind": "StatefulSet", "namespace": "default", "name": "api"}]`,
+			want: []string{"StatefulSet default/api"}},
+		{name: "yaml", list: "items:\n- kind: Deployment\n  namespace: payments\n  name: api\n",
+			want: []string{"Deployment payments/api"}},
+		{name: "yaml array", list: "- kind: Deployment\n  namespace: payments\n  name: worker\n",
+			want: []string{"Deployment payments/worker"}},
+		{name: "missing workload", list: `[{"kind": "Deployment", "namespace": "default", "name": "gone"}]`},
+		{name: "empty", list: ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "workloads")
+		if err := os.WriteFile(path, []byte(tt.list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		items, err := readWorkloadList(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, w := range selectListedWorkloads(candidates, items) {
+			got = append(got, string(w.Kind)+" "+w.Namespace+"/"+w.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: selected %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadWorkloadListInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workloads")
+	if err := os.WriteFile(path, []byte(`{"items": "api"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readWorkloadList(path); err == nil || !strings.Contains(err.Error(), "parse workload list") {
+		t.Errorf("readWorkloadList() error = %v, want a parse error", err)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultPlanPath = "migrate-plan.yaml"
+
+// planActions are the actions a plan can be created for, by command name.
+var planActions = map[string]WorkloadAction{
+	"migrate":      migrateAction,
+	"rollback":     rollbackAction,
+	"arm-patch":    armPatchAction,
+	"arm-rollback": armRollbackAction,
+}
+
+// Plan is the reviewable plan file written by the plan command and executed by
+// the apply command.
+type Plan struct {
+	Action    string     `json:"action"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Items     []PlanItem `json:"items"`
+}
+
+// PlanItem is the merge patch of one workload. ResourceVersion and Generation
+// are the versions of the workload the patch was computed from.
+type PlanItem struct {
+	Cluster         string          `json:"cluster,omitempty"`
+	Kind            WorkloadKind    `json:"kind"`
+	Namespace       string          `json:"namespace"`
+	Name            string          `json:"name"`
+	ResourceVersion string          `json:"resourceVersion"`
+	Generation      int64           `json:"generation"`
+	Patch           json.RawMessage `json:"patch"`
+}
+
+func (i *PlanItem) key() string {
+	return workloadKey(i.Cluster, i.Kind, i.Namespace, i.Name)
+}
+
+// clusters returns the clusters of the items in the order of the plan, the
+// empty name for a plan of a single cluster.
+func (p *Plan) clusters() []string {
+	var clusters []string
+	for _, item := range p.Items {
+		if !slices.Contains(clusters, item.Cluster) {
+			clusters = append(clusters, item.Cluster)
+		}
+	}
+	return clusters
+}
+
+func (i *PlanItem) workload() Workload {
+	return Workload{Cluster: i.Cluster, Kind: i.Kind, Namespace: i.Namespace, Name: i.Name}
+}
+
+// planState records the progress of the apply command, next to the plan file.
+type planState struct {
+	Plan string `json:"plan"`
+	// Action and PlanCreatedAt identify the plan the state belongs to, a
+	// plan written again to the same file starts with a new state.
+	Action        string                   `json:"action"`
+	PlanCreatedAt time.Time                `json:"planCreatedAt"`
+	UpdatedAt     time.Time                `json:"updatedAt"`
+	Items         map[string]planItemState `json:"items"`
+}
+
+type planItemState struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func actionNames() []string {
+	names := make([]string, 0, len(planActions))
+	for name := range planActions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	actionName := fs.String("action", "", "action to plan, one of "+strings.Join(actionNames(), ", "))
+	planPath := fs.String("plan-file", defaultPlanPath, "plan file to write, JSON if the name ends with .json, YAML otherwise")
+	selectedWorkloads, err := loadSelectedWorkloads(fs, args, true)
+	if err != nil {
+		return err
+	}
+	action, ok := planActions[*actionName]
+	if !ok {
+		return newUsageError(fmt.Errorf("invalid --action %q, must be one of %s", *actionName, strings.Join(actionNames(), ", ")))
+	}
+
+	ctx := context.Background()
+	plan := &Plan{Action: *actionName, CreatedAt: time.Now()}
+	failed := 0
+	for _, workload := range selectedWorkloads {
+		obj, newObj, err := prepareWorkloadChange(ctx, &workload, action)
+		var patch []byte
+		if err == nil {
+			patch, err = createWorkloadPatch(obj, newObj)
+		}
+		if err != nil {
+			fmt.Printf("Failed to plan %s of %s workload %s/%s: %v\n", *actionName, workload.Kind,
+				workload.Namespace, workload.Name, err)
+			failed++
+			continue
+		}
+		if isEmptyPatch(patch) {
+			fmt.Printf("Skip %s %s/%s, it has no changes\n", workload.Kind, workload.Namespace, workload.Name)
+			continue
+		}
+
+		plan.Items = append(plan.Items, PlanItem{
+			Cluster:         workload.Cluster,
+			Kind:            workload.Kind,
+			Namespace:       workload.Namespace,
+			Name:            workload.Name,
+			ResourceVersion: obj.GetResourceVersion(),
+			Generation:      obj.GetGeneration(),
+			Patch:           patch,
+		})
+	}
+
+	if err := writePlan(*planPath, plan); err != nil {
+		return err
+	}
+	// The progress of a previous plan of the file does not apply to this one.
+	if err := os.Remove(defaultPlanStatePath(*planPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove the plan state: %w", err)
+	}
+	printPlan(plan, nil)
+	fmt.Printf("Wrote the plan with %d items to %s, review it and run 'migrate apply --plan-file %s'\n",
+		len(plan.Items), *planPath, *planPath)
+	return newWorkloadFailures(failed, len(selectedWorkloads))
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	opts := &globalOptions{}
+	opts.addFlags(fs)
+	addDryRunFlag(fs)
+	addRolloutWaitFlags(fs)
+	planPath := fs.String("plan-file", defaultPlanPath, "plan file to apply")
+	statePath := fs.String("state", "", "file which records the status of every item, defaults to the plan file with the suffix .state.json")
+	if err := fs.Parse(args); err != nil {
+		return newUsageError(err)
+	}
+	if fs.NArg() > 0 {
+		return newUsageError(fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " ")))
+	}
+	if *statePath == "" {
+		*statePath = defaultPlanStatePath(*planPath)
+	}
+
+	plan, err := readPlan(*planPath)
+	if err != nil {
+		return err
+	}
+	action, ok := planActions[plan.Action]
+	if !ok {
+		return fmt.Errorf("plan %s has the unknown action %q", *planPath, plan.Action)
+	}
+	state, err := loadPlanState(*statePath, *planPath, plan)
+	if err != nil {
+		return err
+	}
+	for _, item := range plan.Items {
+		opts.kube.scopeNamespaces([]string{item.Namespace})
+	}
+	// A plan of several clusters is applied to the clusters it was planned for,
+	// unless --contexts is given.
+	if len(opts.kube.contexts) == 0 {
+		opts.kube.useContexts(plan.clusters())
+	}
+	if err := opts.init(); err != nil {
+		return err
+	}
+
+	printPlan(plan, state)
+	failed, skipped := 0, 0
+	for _, cluster := range plan.clusters() {
+		if err := useCluster(cluster); err != nil {
+			return err
+		}
+		if cluster != "" {
+			fmt.Printf("Applying the plan to cluster %s\n", cluster)
+		}
+		for i := range plan.Items {
+			item := &plan.Items[i]
+			if item.Cluster != cluster {
+				continue
+			}
+			itemState := state.Items[item.key()]
+			if itemState.Status == itemStatusDone {
+				continue
+			}
+			if failed > 0 && !rolloutWait.continueOnError {
+				skipped++
+				continue
+			}
+
+			status, err := applyPlanItem(*statePath, state, item, action, itemState.Status)
+			if err != nil {
+				fmt.Printf("Failed to apply %s of %s workload %s/%s: %v\n", plan.Action, item.Kind, item.Namespace, item.Name, err)
+				failed++
+			}
+			if err := recordPlanItem(*statePath, state, item, status, err); err != nil {
+				return err
+			}
+		}
+	}
+	if fleetMode() {
+		printPlanClusters(plan, state)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Stopped applying the plan, skipped %d items, run the command again to resume\n", skipped)
+		return &workloadFailures{failed: failed, skipped: skipped, total: len(plan.Items)}
+	}
+	return newWorkloadFailures(failed, len(plan.Items))
+}
+
+// applyPlanItem patches the workload of the item unless a previous run already
+// did, and waits for its rollout. It returns the new status of the item.
+func applyPlanItem(statePath string, state *planState, item *PlanItem, action WorkloadAction, status string) (string, error) {
+	workload := item.workload()
+	var err error
+	if status != itemStatusPatched {
+		status, err = patchPlanItem(item, &workload, action)
+		if err == nil && status == itemStatusPatched {
+			// Record the patch before waiting, a resumed run only waits.
+			if err := recordPlanItem(statePath, state, item, status, nil); err != nil {
+				return status, err
+			}
+		}
+	}
+	if err == nil && status == itemStatusPatched {
+		status = itemStatusDone
+		if rolloutWait.waiting() {
+			if err = awaitWorkloadRollout(&workload, action, time.Now()); err != nil {
+				status = itemStatusFailed
+			}
+		}
+	}
+	return status, err
+}
+
+// patchPlanItem patches the workload of the item with the planned patch after
+// checking it for drift, and returns the new status of the item.
+func patchPlanItem(item *PlanItem, workload *Workload, action WorkloadAction) (string, error) {
+	ctx := context.Background()
+	drifted, applied, err := checkPlanItemDrift(ctx, item, workload, action)
+	if err != nil {
+		return itemStatusFailed, err
+	}
+	if drifted {
+		return itemStatusDrifted, fmt.Errorf("the workload changed since planning, plan it again")
+	}
+	if applied || isEmptyPatch(item.Patch) {
+		fmt.Printf("%s %s/%s already has the planned changes\n", item.Kind, item.Namespace, item.Name)
+		return itemStatusDone, nil
+	}
+
+	if dryRunMode != DryRunNone {
+		fmt.Printf("\n--- %s %s/%s\nMerge patch:\n%s\n", item.Kind, item.Namespace, item.Name, item.Patch)
+	}
+	if err := sendWorkloadPatch(ctx, item.Namespace, item.Name, item.Kind, item.Patch); err != nil {
+		return itemStatusFailed, err
+	}
+	if dryRunMode != DryRunNone {
+		return itemStatusPending, nil
+	}
+	return itemStatusPatched, nil
+}
+
+func recordPlanItem(path string, state *planState, item *PlanItem, status string, err error) error {
+	itemState := planItemState{Status: status, UpdatedAt: time.Now()}
+	if err != nil {
+		itemState.Error = err.Error()
+	}
+	state.Items[item.key()] = itemState
+	return savePlanState(path, state)
+}
+
+// checkPlanItemDrift compares the workload with the version the item was
+// planned from. A changed resourceVersion is only drift when the patch computed
+// from the current workload differs from the planned one, status updates and
+// unrelated metadata changes do not invalidate the plan. applied reports that
+// the planned changes are already in the workload. The current version is kept
+// as the patched version of the workload.
+func checkPlanItemDrift(ctx context.Context, item *PlanItem, workload *Workload, action WorkloadAction) (drifted, applied bool, err error) {
+	obj, newObj, err := prepareWorkloadChange(ctx, workload, action)
+	if err != nil {
+		return false, false, err
+	}
+	workload.patchedVersion = obj.GetResourceVersion()
+	if obj.GetResourceVersion() == item.ResourceVersion {
+		return false, false, nil
+	}
+
+	patch, err := createWorkloadPatch(obj, newObj)
+	if err != nil {
+		return false, false, err
+	}
+	if isEmptyPatch(patch) {
+		return false, true, nil
+	}
+	if !jsonpatch.Equal(patch, item.Patch) {
+		fmt.Printf("%s %s/%s drifted: resourceVersion %s -> %s, generation %d -> %d, patch now:\n%s\n",
+			item.Kind, item.Namespace, item.Name, item.ResourceVersion, obj.GetResourceVersion(),
+			item.Generation, obj.GetGeneration(), patch)
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+func writePlan(path string, plan *Plan) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = json.MarshalIndent(plan, "", "  ")
+	} else {
+		data, err = yaml.Marshal(plan)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
+
+func readPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plan: %w", err)
+	}
+	plan := &Plan{}
+	if err := yaml.UnmarshalStrict(data, plan); err != nil {
+		return nil, fmt.Errorf("parse plan %s: %w", path, err)
+	}
+	return plan, nil
+}
+
+func defaultPlanStatePath(planPath string) string {
+	return strings.TrimSuffix(planPath, filepath.Ext(planPath)) + ".state.json"
+}
+
+// loadPlanState reads the progress of the plan. A state recorded for another
+// plan is refused, its items would be skipped as done.
+func loadPlanState(path, planPath string, plan *Plan) (*planState, error) {
+	state := &planState{Plan: planPath, Action: plan.Action, PlanCreatedAt: plan.CreatedAt,
+		Items: make(map[string]planItemState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read plan state: %w", err)
+	}
+	recorded := &planState{}
+	if err := json.Unmarshal(data, recorded); err != nil {
+		return nil, fmt.Errorf("parse plan state %s: %w", path, err)
+	}
+	if recorded.Action != plan.Action || !recorded.PlanCreatedAt.Equal(plan.CreatedAt) {
+		return nil, fmt.Errorf("plan state %s belongs to another plan (action %q, created at %s), remove it or use --state",
+			path, recorded.Action, recorded.PlanCreatedAt.Format(time.RFC3339))
+	}
+	state = recorded
+	if state.Items == nil {
+		state.Items = make(map[string]planItemState)
+	}
+	return state, nil
+}
+
+func savePlanState(path string, state *planState) error {
+	if dryRunMode != DryRunNone {
+		return nil
+	}
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write plan state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func printPlan(plan *Plan, state *planState) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.SetTitle("Plan: %s", plan.Action)
+	t.AppendHeader(insertClusterColumn(table.Row{"Namespace", "Kind", "Name", "ResourceVersion", "Status"}, 0, "Cluster"))
+
+	for _, item := range plan.Items {
+		status := itemStatusPending
+		if state != nil && state.Items[item.key()].Status != "" {
+			status = state.Items[item.key()].Status
+		}
+		t.AppendRow(insertClusterColumn(table.Row{item.Namespace, item.Kind, item.Name, item.ResourceVersion,
+			formatItemStatus(status)}, 0, item.Cluster))
+	}
+	t.Render()
+}
+
+// printPlanClusters prints the number of items per status of every cluster of
+// the plan.
+func printPlanClusters(plan *Plan, state *planState) {
+	statuses := []string{itemStatusDone, itemStatusFailed, itemStatusDrifted, itemStatusPatched, itemStatusPending}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.SetTitle("Clusters: %s", plan.Action)
+	header := table.Row{"Cluster", "Items"}
+	for _, status := range statuses {
+		header = append(header, status)
+	}
+	t.AppendHeader(header)
+
+	for _, cluster := range plan.clusters() {
+		counts := make(map[string]int)
+		items := 0
+		for _, item := range plan.Items {
+			if item.Cluster != cluster {
+				continue
+			}
+			items++
+			status := state.Items[item.key()].Status
+			if status == "" {
+				status = itemStatusPending
+			}
+			counts[status]++
+		}
+		row := table.Row{cluster, items}
+		for _, status := range statuses {
+			row = append(row, counts[status])
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+}
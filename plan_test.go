@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPlanState(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	plan := &Plan{Action: "migrate", CreatedAt: createdAt}
+	item := &PlanItem{Kind: WorkloadDeployment, Namespace: "default", Name: "api"}
+
+	tests := []struct {
+		name    string
+		plan    *Plan
+		wantErr string
+	}{
+		{name: "same plan", plan: plan},
+		{name: "other action", plan: &Plan{Action: "rollback", CreatedAt: createdAt}, wantErr: "belongs to another plan"},
+		{name: "planned again", plan: &Plan{Action: "migrate", CreatedAt: createdAt.Add(time.Hour)},
+			wantErr: "belongs to another plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.state.json")
+			state, err := loadPlanState(path, "plan.yaml", plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := recordPlanItem(path, state, item, itemStatusDone, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			state, err = loadPlanState(path, "plan.yaml", tt.plan)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadPlanState() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status := state.Items[item.key()].Status; status != itemStatusDone {
+				t.Errorf("status of %s = %q, want %q", item.key(), status, itemStatusDone)
+			}
+		})
+	}
+}
+
+func TestLoadPlanStateWithoutFile(t *testing.T) {
+	plan := &Plan{Action: "arm-patch", CreatedAt: time.Now()}
+	state, err := loadPlanState(filepath.Join(t.TempDir(), "missing.json"), "plan.yaml", plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Action != plan.Action || !state.PlanCreatedAt.Equal(plan.CreatedAt) || len(state.Items) != 0 {
+		t.Errorf("loadPlanState() = %+v, want an empty state of the plan", state)
+	}
+}
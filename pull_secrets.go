@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pullSecrets caches the registry credentials of the image pull secrets and the
+// pull secrets of the service accounts, like the kubelet resolves them.
+type pullSecrets struct {
+	mu              sync.Mutex
+	secrets         map[string][]registryCredential
+	serviceAccounts map[string][]string
+	keychains       map[string]authn.Keychain
+	warned          map[string]bool
+}
+
+// clusterPullSecrets are the pull secrets of the cluster in use, see
+// useCluster.
+var clusterPullSecrets = newPullSecrets()
+
+func newPullSecrets() *pullSecrets {
+	return &pullSecrets{
+		secrets:         make(map[string][]registryCredential),
+		serviceAccounts: make(map[string][]string),
+		keychains:       make(map[string]authn.Keychain),
+		warned:          make(map[string]bool),
+	}
+}
+
+// registryCredential is an entry of a docker config, matched against the
+// image repository like the kubelet does.
+type registryCredential struct {
+	host string
+	path string
+	auth authn.AuthConfig
+}
+
+// workloadKeychain returns the keychain for the images of the pod spec: the
+// pull secrets of the pod spec and of its service account come first, then the
+// cloud helpers and ~/.docker/config.json. Pod specs with the same pull
+// secrets share the keychain.
+func workloadKeychain(namespace string, podSpec *corev1.PodSpec) authn.Keychain {
+	if kubeClient == nil {
+		return keychain
+	}
+
+	ctx := context.Background()
+	names := make([]string, 0, len(podSpec.ImagePullSecrets))
+	for _, ref := range podSpec.ImagePullSecrets {
+		names = append(names, ref.Name)
+	}
+	serviceAccount := podSpec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	names = append(names, clusterPullSecrets.serviceAccountSecrets(ctx, namespace, serviceAccount)...)
+
+	key := namespace + "/" + strings.Join(names, ",")
+	clusterPullSecrets.mu.Lock()
+	kc, ok := clusterPullSecrets.keychains[key]
+	clusterPullSecrets.mu.Unlock()
+	if ok {
+		return kc
+	}
+
+	var credentials []registryCredential
+	for _, secretName := range names {
+		credentials = append(credentials, clusterPullSecrets.credentials(ctx, namespace, secretName)...)
+	}
+	kc = keychain
+	if len(credentials) > 0 {
+		kc = authn.NewMultiKeychain(pullSecretKeychain(credentials), keychain)
+	}
+	clusterPullSecrets.mu.Lock()
+	clusterPullSecrets.keychains[key] = kc
+	clusterPullSecrets.mu.Unlock()
+	return kc
+}
+
+func (p *pullSecrets) serviceAccountSecrets(ctx context.Context, namespace, name string) []string {
+	key := namespace + "/" + name
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if names, ok := p.serviceAccounts[key]; ok {
+		return names
+	}
+
+	var names []string
+	sa, err := kubeClient.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		p.warn("service account "+key, err)
+	} else {
+		for _, ref := range sa.ImagePullSecrets {
+			names = append(names, ref.Name)
+		}
+	}
+	p.serviceAccounts[key] = names
+	return names
+}
+
+func (p *pullSecrets) credentials(ctx context.Context, namespace, name string) []registryCredential {
+	key := namespace + "/" + name
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if credentials, ok := p.secrets[key]; ok {
+		return credentials
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	var credentials []registryCredential
+	if err == nil {
+		credentials, err = parsePullSecret(secret)
+	}
+	if err != nil {
+		p.warn("image pull secret "+key, err)
+	}
+	p.secrets[key] = credentials
+	return credentials
+}
+
+// warn reports a pull secret which can not be used once, a missing secret is
+// ignored like the kubelet does.
+func (p *pullSecrets) warn(what string, err error) {
+	if apierrors.IsNotFound(err) || p.warned[what] {
+		return
+	}
+	p.warned[what] = true
+	fmt.Fprintf(os.Stderr, "Failed to read %s, continue without it: %v\n", what, err)
+}
+
+// parsePullSecret parses the docker config of a kubernetes.io/dockerconfigjson
+// or kubernetes.io/dockercfg secret.
+func parsePullSecret(secret *corev1.Secret) ([]registryCredential, error) {
+	var auths map[string]authn.AuthConfig
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		config := struct {
+			Auths map[string]authn.AuthConfig `json:"auths"`
+		}{}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", corev1.DockerConfigJsonKey, err)
+		}
+		auths = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", corev1.DockerConfigKey, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported secret type %s", secret.Type)
+	}
+
+	credentials := make([]registryCredential, 0, len(auths))
+	for registry, auth := range auths {
+		host, repoPath := parseRegistryKey(registry)
+		credentials = append(credentials, registryCredential{host: host, path: repoPath, auth: auth})
+	}
+	return credentials, nil
+}
+
+// parseRegistryKey splits a docker config key, like https://index.docker.io/v1/,
+// registry.example.com:5000 or *.example.com/team, into host and path.
+func parseRegistryKey(key string) (string, string) {
+	if !strings.Contains(key, "://") {
+		key = "https://" + key
+	}
+	u, err := url.Parse(key)
+	if err != nil {
+		return key, ""
+	}
+	host := u.Host
+	repoPath := strings.Trim(u.Path, "/")
+	if host == "docker.io" || host == "registry-1.docker.io" || host == "index.docker.io" {
+		host = "index.docker.io"
+		repoPath = ""
+	}
+	if repoPath == "v1" || repoPath == "v2" {
+		repoPath = ""
+	}
+	return host, repoPath
+}
+
+type pullSecretKeychain []registryCredential
+
+// Resolve returns the credential of the most specific matching key, the host
+// may contain globs per domain part and the path must be a prefix of the
+// repository.
+func (k pullSecretKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+	repository := strings.TrimPrefix(strings.TrimPrefix(target.String(), registry), "/")
+
+	var best *registryCredential
+	for i, credential := range k {
+		if !matchRegistryHost(credential.host, registry) {
+			continue
+		}
+		if credential.path != "" && repository != credential.path &&
+			!strings.HasPrefix(repository, credential.path+"/") {
+			continue
+		}
+		if best == nil || len(credential.host)+len(credential.path) > len(best.host)+len(best.path) {
+			best = &k[i]
+		}
+	}
+	if best == nil {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(best.auth), nil
+}
+
+func matchRegistryHost(pattern, host string) bool {
+	patternParts := strings.Split(pattern, ".")
+	hostParts := strings.Split(host, ".")
+	if len(patternParts) != len(hostParts) {
+		return false
+	}
+	for i := range patternParts {
+		if ok, err := path.Match(patternParts[i], hostParts[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
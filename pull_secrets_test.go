@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPullSecretKeychain(t *testing.T) {
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths": {
+			"https://index.docker.io/v1/": {"username": "hub"},
+			"registry.example.com:5000": {"username": "port"},
+			"*.example.com": {"username": "glob"},
+			"*.example.com/team": {"username": "team"},
+			"*.example.com/team/app": {"username": "app"}
+		}}`)},
+	}
+	credentials, err := parsePullSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keychain := pullSecretKeychain(credentials)
+
+	tests := []struct {
+		repository string
+		want       string
+	}{
+		{repository: "nginx", want: "hub"},
+		{repository: "docker.io/bitnami/redis", want: "hub"},
+		{repository: "registry.example.com:5000/app", want: "port"},
+		{repository: "registry.example.com/app", want: "glob"},
+		{repository: "registry.example.com/team/web", want: "team"},
+		{repository: "registry.example.com/team/app", want: "app"},
+		{repository: "registry.example.com/team/app/worker", want: "app"},
+		{repository: "registry.example.com/teams/web", want: "glob"},
+		{repository: "eu.registry.example.com/app"},
+		{repository: "example.com/app"},
+		{repository: "ghcr.io/org/app"},
+	}
+	for _, tt := range tests {
+		repo, err := name.NewRepository(tt.repository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authenticator, err := keychain.Resolve(repo)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.repository, err)
+		}
+		got := ""
+		if authenticator != authn.Anonymous {
+			config, err := authenticator.Authorization()
+			if err != nil {
+				t.Fatalf("%s: %v", tt.repository, err)
+			}
+			got = config.Username
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%s) uses the credential %q, want %q", tt.repository, got, tt.want)
+		}
+	}
+}
+
+func TestParseRegistryKey(t *testing.T) {
+	tests := []struct {
+		key, host, path string
+	}{
+		{key: "https://index.docker.io/v1/", host: "index.docker.io"},
+		{key: "docker.io", host: "index.docker.io"},
+		{key: "registry.example.com:5000", host: "registry.example.com:5000"},
+		{key: "http://registry.example.com/v2/", host: "registry.example.com"},
+		{key: "*.example.com/team/app", host: "*.example.com", path: "team/app"},
+	}
+	for _, tt := range tests {
+		if host, path := parseRegistryKey(tt.key); host != tt.host || path != tt.path {
+			t.Errorf("parseRegistryKey(%q) = %q, %q, want %q, %q", tt.key, host, path, tt.host, tt.path)
+		}
+	}
+}
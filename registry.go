@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// registrySettings are the mirrors and registry connections of the config.
+type registrySettings struct {
+	mirrors    []MirrorConfig
+	plainHTTP  map[string]bool
+	transports map[string]http.RoundTripper
+}
+
+var registries = &registrySettings{}
+
+var defaultRegistryTransport http.RoundTripper = &throttledTransport{base: remote.DefaultTransport}
+
+// configureRegistries validates the mirrors and creates the transports of the
+// registries with custom TLS settings.
+func configureRegistries(config *Config) error {
+	settings := &registrySettings{
+		plainHTTP:  make(map[string]bool),
+		transports: make(map[string]http.RoundTripper),
+	}
+
+	for _, mirror := range config.Mirrors {
+		if mirror.Prefix == "" || mirror.Mirror == "" {
+			return fmt.Errorf("mirror %+v requires prefix and mirror", mirror)
+		}
+		mirror.Prefix = normalizeRepositoryPrefix(mirror.Prefix)
+		mirror.Mirror = strings.TrimSuffix(mirror.Mirror, "/")
+		settings.mirrors = append(settings.mirrors, mirror)
+	}
+
+	for _, registry := range config.Registries {
+		if registry.Host == "" {
+			return fmt.Errorf("registry %+v requires host", registry)
+		}
+		host := normalizeRepositoryPrefix(registry.Host)
+		settings.plainHTTP[host] = registry.PlainHTTP
+		if !registry.InsecureSkipVerify && registry.CAFile == "" {
+			continue
+		}
+
+		tlsConfig := &tls.Config{InsecureSkipVerify: registry.InsecureSkipVerify}
+		if registry.CAFile != "" {
+			pem, err := os.ReadFile(registry.CAFile)
+			if err != nil {
+				return fmt.Errorf("read CA bundle of registry %s: %w", registry.Host, err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("CA bundle %s of registry %s has no certificates", registry.CAFile, registry.Host)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport := remote.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		settings.transports[host] = &throttledTransport{base: transport}
+	}
+
+	registries = settings
+	return nil
+}
+
+// normalizeRepositoryPrefix returns the prefix as go-containerregistry names the
+// repositories, Docker Hub is index.docker.io.
+func normalizeRepositoryPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	host, rest, _ := strings.Cut(prefix, "/")
+	if host == "docker.io" || host == "registry-1.docker.io" {
+		host = name.DefaultRegistry
+	}
+	if rest == "" {
+		return host
+	}
+	return host + "/" + rest
+}
+
+// resolve rewrites the image reference to the first mirror whose prefix
+// matches the repository, and returns the remote options of the registry the
+// image is fetched from. The requests are throttled per registry host.
+func (s *registrySettings) resolve(ref name.Reference) (name.Reference, []remote.Option, error) {
+	target := ref
+	repository := ref.Context().Name()
+	for _, mirror := range s.mirrors {
+		if repository != mirror.Prefix && !strings.HasPrefix(repository, mirror.Prefix+"/") {
+			continue
+		}
+
+		rewritten := mirror.Mirror + strings.TrimPrefix(repository, mirror.Prefix)
+		switch r := ref.(type) {
+		case name.Digest:
+			rewritten += "@" + r.DigestStr()
+		case name.Tag:
+			rewritten += ":" + r.TagStr()
+		}
+		opts := []name.Option{name.WeakValidation}
+		if s.plainHTTP[registryHost(rewritten)] {
+			opts = append(opts, name.Insecure)
+		}
+		var err error
+		if target, err = name.ParseReference(rewritten, opts...); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse mirrored image reference %s: %w", rewritten, err)
+		}
+		break
+	}
+
+	host := target.Context().RegistryStr()
+	if target == ref && s.plainHTTP[host] {
+		var err error
+		if target, err = name.ParseReference(ref.Name(), name.WeakValidation, name.Insecure); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse image reference: %w", err)
+		}
+	}
+
+	transport, ok := s.transports[host]
+	if !ok {
+		transport = defaultRegistryTransport
+	}
+	return target, []remote.Option{remote.WithTransport(transport)}, nil
+}
+
+func registryHost(reference string) string {
+	host, _, _ := strings.Cut(reference, "/")
+	return host
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestRegistriesResolve(t *testing.T) {
+	defer func(settings *registrySettings) { registries = settings }(registries)
+	err := configureRegistries(&Config{
+		Mirrors: []MirrorConfig{
+			{Prefix: "gcr.io/my-project", Mirror: "harbor.internal/gcr-proxy/"},
+			{Prefix: "docker.io", Mirror: "mirror.internal:5000/dockerhub"},
+			{Prefix: "gcr.io", Mirror: "harbor.internal/gcr"},
+		},
+		Registries: []RegistryConfig{
+			{Host: "mirror.internal:5000", PlainHTTP: true},
+			{Host: "registry.local:5000", PlainHTTP: true},
+			{Host: "harbor.internal", InsecureSkipVerify: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registries.transports["harbor.internal"]; !ok || len(registries.transports) != 1 {
+		t.Errorf("transports of %d registries, want only harbor.internal", len(registries.transports))
+	}
+
+	tests := []struct {
+		image      string
+		want       string
+		wantScheme string
+	}{
+		{image: "nginx:1.25", want: "mirror.internal:5000/dockerhub/library/nginx:1.25", wantScheme: "http"},
+		{image: "docker.io/bitnami/redis@sha256:" + testDigest,
+			want: "mirror.internal:5000/dockerhub/bitnami/redis@sha256:" + testDigest, wantScheme: "http"},
+		{image: "gcr.io/my-project/app:v1", want: "harbor.internal/gcr-proxy/app:v1", wantScheme: "https"},
+		{image: "gcr.io/my-project-2/app:v1", want: "harbor.internal/gcr/my-project-2/app:v1", wantScheme: "https"},
+		{image: "registry.local:5000/app:v1", want: "registry.local:5000/app:v1", wantScheme: "http"},
+		{image: "ghcr.io/org/app:v1", want: "ghcr.io/org/app:v1", wantScheme: "https"},
+	}
+	for _, tt := range tests {
+		ref, err := name.ParseReference(tt.image, name.WeakValidation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, _, err := registries.resolve(ref)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.image, err)
+		}
+		if target.Name() != tt.want || target.Context().Scheme() != tt.wantScheme {
+			t.Errorf("resolve(%s) = %s over %s, want %s over %s", tt.image, target.Name(),
+				target.Context().Scheme(), tt.want, tt.wantScheme)
+		}
+	}
+}
+
+const testDigest = "0000000000000000000000000000000000000000000000000000000000000000"
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/time/rate"
+)
+
+type registryLimitOptions struct {
+	qps         float64
+	burst       int
+	concurrency int
+	maxRetries  int
+}
+
+var registryLimits = registryLimitOptions{qps: 10, burst: 20, concurrency: 4, maxRetries: 5}
+
+func (o *registryLimitOptions) addFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&o.qps, "registry-qps", o.qps, "maximum requests per second to a registry")
+	fs.IntVar(&o.burst, "registry-burst", o.burst, "maximum burst of requests to a registry")
+	fs.IntVar(&o.concurrency, "registry-concurrency", o.concurrency, "maximum concurrent requests to a registry")
+	fs.IntVar(&o.maxRetries, "registry-max-retries", o.maxRetries,
+		"how often an image lookup is retried when the registry answers 429 Too Many Requests")
+}
+
+// registryHostLimiter throttles the requests to one registry host. After a 429
+// response all requests to the host wait until its Retry-After passed.
+type registryHostLimiter struct {
+	limiter *rate.Limiter
+	slots   chan struct{}
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+var (
+	registryHostLimitersMu sync.Mutex
+	registryHostLimiters   = make(map[string]*registryHostLimiter)
+)
+
+func getRegistryHostLimiter(host string) *registryHostLimiter {
+	registryHostLimitersMu.Lock()
+	defer registryHostLimitersMu.Unlock()
+
+	l, ok := registryHostLimiters[host]
+	if !ok {
+		l = &registryHostLimiter{
+			limiter: rate.NewLimiter(rate.Limit(registryLimits.qps), max(registryLimits.burst, 1)),
+			slots:   make(chan struct{}, max(registryLimits.concurrency, 1)),
+		}
+		registryHostLimiters[host] = l
+	}
+	return l
+}
+
+func (l *registryHostLimiter) block(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// throttledTransport applies the limits of the registry host to every request,
+// including the token requests.
+type throttledTransport struct {
+	base http.RoundTripper
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := getRegistryHostLimiter(req.URL.Host)
+
+	l.mu.Lock()
+	wait := time.Until(l.blockedUntil)
+	l.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	if err := l.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	defer func() { <-l.slots }()
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		l.block(parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+	return resp, err
+}
+
+// parseRetryAfter parses the seconds or the HTTP date of a Retry-After header,
+// without the header the host is blocked for a second.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return time.Second
+}
+
+// isTooManyRequests reports whether the registry rejected the request with 429
+// Too Many Requests or the TOOMANYREQUESTS error code.
+func isTooManyRequests(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	for _, diagnostic := range terr.Errors {
+		if diagnostic.Code == transport.TooManyRequestsErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccessDenied reports whether the registry rejected the credentials.
+func isAccessDenied(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden {
+		return true
+	}
+	for _, diagnostic := range terr.Errors {
+		if diagnostic.Code == transport.UnauthorizedErrorCode || diagnostic.Code == transport.DeniedErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTooManyRequests retries the lookup with exponential backoff while the
+// registry answers 429, at most --registry-max-retries times. The Retry-After
+// of the registry is honored by the throttled transport.
+func retryTooManyRequests[T any](lookup func() (T, error)) (T, error) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = time.Minute
+	b.MaxElapsedTime = 0
+
+	var result T
+	err := backoff.Retry(func() error {
+		var err error
+		result, err = lookup()
+		if err != nil && !isTooManyRequests(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithMaxRetries(b, uint64(max(registryLimits.maxRetries, 0))))
+	return result, err
+}
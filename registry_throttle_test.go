@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{value: "", min: time.Second, max: time.Second},
+		{value: "0", min: 0, max: 0},
+		{value: "30", min: 30 * time.Second, max: 30 * time.Second},
+		{value: "-5", min: time.Second, max: time.Second},
+		{value: "soon", min: time.Second, max: time.Second},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 55 * time.Second, max: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestIsTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "status 429", err: &transport.Error{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "wrapped status 429", err: fmt.Errorf("get manifest: %w",
+			&transport.Error{StatusCode: http.StatusTooManyRequests}), want: true},
+		{name: "error code", err: &transport.Error{StatusCode: http.StatusServiceUnavailable,
+			Errors: []transport.Diagnostic{{Code: transport.TooManyRequestsErrorCode}}}, want: true},
+		{name: "unauthorized", err: &transport.Error{StatusCode: http.StatusUnauthorized,
+			Errors: []transport.Diagnostic{{Code: transport.UnauthorizedErrorCode}}}, want: false},
+		{name: "not found", err: &transport.Error{StatusCode: http.StatusNotFound}, want: false},
+		{name: "plain error", err: errors.New("429 Too Many Requests"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isTooManyRequests(tt.err); got != tt.want {
+			t.Errorf("%s: isTooManyRequests() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryTooManyRequests(t *testing.T) {
+	defer func(limits registryLimitOptions) { registryLimits = limits }(registryLimits)
+	registryLimits.maxRetries = 0
+
+	tooMany := &transport.Error{StatusCode: http.StatusTooManyRequests}
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "success", err: nil, wantCalls: 1},
+		{name: "other error is not retried", err: errors.New("boom"), wantCalls: 1},
+		{name: "429 without retries left", err: tooMany, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		_, err := retryTooManyRequests(func() (string, error) {
+			calls++
+			return "", tt.err
+		})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: retryTooManyRequests() error = %v, want %v", tt.name, err, tt.err)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: lookup called %d times, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+const (
+	deploymentRevisionAnnotation   = "deployment.kubernetes.io/revision"
+	daemonSetTemplateGenerationKey = "pod-template-generation"
+
+	execFormatError = "exec format error"
+)
+
+// unhealthyRolloutError is returned by the rollout guard when a pod of the new
+// revision can not become healthy.
+type unhealthyRolloutError struct {
+	pod    string
+	reason string
+}
+
+func (e *unhealthyRolloutError) Error() string {
+	return fmt.Sprintf("pod %s: %s", e.pod, e.reason)
+}
+
+// guardRollbackAction returns the rollback action which reverts the scheduling
+// change of a patch action.
+func guardRollbackAction(action WorkloadAction) (WorkloadAction, bool) {
+	if action.Rollback || action.Scheduling == "" {
+		return WorkloadAction{}, false
+	}
+	for _, rollback := range []WorkloadAction{rollbackAction, armRollbackAction} {
+		if rollback.Scheduling == action.Scheduling {
+			return rollback, true
+		}
+	}
+	return WorkloadAction{}, false
+}
+
+// rolloutGuard checks the pods of the new revision of a patched workload.
+type rolloutGuard struct {
+	// since is the time of the patch, it is used to find the new pods of the
+	// workloads which do not label their revisions.
+	since time.Time
+}
+
+func (g *rolloutGuard) check(ctx context.Context, obj WorkloadObject) error {
+	pods, known, err := listRevisionPods(ctx, obj, g.since)
+	if err != nil {
+		fmt.Printf("Failed to list the new pods of %s/%s, retrying: %v\n", obj.GetNamespace(), obj.GetName(), err)
+		return nil
+	}
+	if !known {
+		return nil
+	}
+	for i := range pods {
+		if reason := unhealthyPodReason(ctx, &pods[i]); reason != "" {
+			return &unhealthyRolloutError{pod: pods[i].Name, reason: reason}
+		}
+	}
+	return nil
+}
+
+// listRevisionPods lists the pods of the current revision of the workload.
+// Without revision labels the pods of the workload created after since are
+// used. known is false while the revision is not known yet.
+func listRevisionPods(ctx context.Context, obj WorkloadObject, since time.Time) ([]corev1.Pod, bool, error) {
+	revision, ok := obj.(revisionPodSelector)
+	if !ok {
+		all, err := getWorkloadPods(ctx, obj)
+		if err != nil {
+			return nil, false, err
+		}
+		pods := make([]corev1.Pod, 0, len(all))
+		for _, pod := range all {
+			if !pod.CreationTimestamp.Time.Before(since.Truncate(time.Second)) {
+				pods = append(pods, pod)
+			}
+		}
+		return pods, true, nil
+	}
+
+	selector, known, err := revision.RevisionPodSelector(ctx)
+	if err != nil || !known {
+		return nil, known, err
+	}
+	inv, err := getInventory()
+	if err != nil {
+		return nil, false, err
+	}
+	list, err := listCached[*corev1.Pod](inv.pods, obj.GetNamespace(), selector)
+	if err != nil {
+		return nil, false, err
+	}
+	pods := make([]corev1.Pod, 0, len(list))
+	for _, pod := range list {
+		pods = append(pods, *pod)
+	}
+	return pods, true, nil
+}
+
+// unhealthyPodReason returns why the pod can not become healthy, or an empty
+// string if it is healthy or may still become healthy.
+func unhealthyPodReason(ctx context.Context, pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == corev1.PodReasonUnschedulable &&
+			time.Since(condition.LastTransitionTime.Time) >= rolloutWait.unschedulableTimeout {
+			return fmt.Sprintf("unschedulable for more than %s: %s", rolloutWait.unschedulableTimeout, condition.Message)
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting == nil {
+			continue
+		}
+		switch reason := status.State.Waiting.Reason; reason {
+		// ErrImagePull is retried, ImagePullBackOff follows when the pulls
+		// keep failing.
+		case "ImagePullBackOff":
+			return fmt.Sprintf("container %s: %s: %s", status.Name, reason, status.State.Waiting.Message)
+		case "CrashLoopBackOff":
+			if hasExecFormatError(ctx, pod, status) {
+				return fmt.Sprintf("container %s: %s, the image does not support the architecture of node %s",
+					status.Name, execFormatError, pod.Spec.NodeName)
+			}
+			return fmt.Sprintf("container %s: %s", status.Name, reason)
+		}
+	}
+	return ""
+}
+
+// hasExecFormatError checks the last termination message and the logs of the
+// previous run of the container for an exec format error, the error of a binary
+// built for another architecture.
+func hasExecFormatError(ctx context.Context, pod *corev1.Pod, status corev1.ContainerStatus) bool {
+	if terminated := status.LastTerminationState.Terminated; terminated != nil &&
+		strings.Contains(terminated.Message, execFormatError) {
+		return true
+	}
+
+	tailLines := int64(20)
+	stream, err := kubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: status.Name,
+		Previous:  true,
+		TailLines: &tailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return false
+	}
+	defer stream.Close()
+	logs, err := io.ReadAll(io.LimitReader(stream, 64*1024))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(logs), execFormatError)
+}
+
+func withLabel(selector labels.Selector, key, value string) (labels.Selector, bool, error) {
+	if value == "" {
+		return nil, false, nil
+	}
+	requirement, err := labels.NewRequirement(key, selection.Equals, []string{value})
+	if err != nil {
+		return nil, false, err
+	}
+	return selector.Add(*requirement), true, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+// testKubeClient points kubeClient to a fake API server which serves the logs
+// of the pods, the previous logs of every container are the annotation "logs"
+// of the pod.
+func testKubeClient(t *testing.T, pods ...*corev1.Pod) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, pod := range pods {
+			if r.URL.Path == "/api/v1/namespaces/"+pod.Namespace+"/pods/"+pod.Name+"/log" {
+				_, _ = w.Write([]byte(pod.Annotations["logs"]))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := kubeClient
+	kubeClient = client
+	t.Cleanup(func() { kubeClient = previous })
+}
+
+// testInventory replaces the inventory with one whose caches hold the objects.
+func testInventory(t *testing.T, objects ...metav1.Object) *clusterInventory {
+	t.Helper()
+	inv := &clusterInventory{}
+	resources := []*inventoryResource{&inv.deployments, &inv.statefulSets, &inv.daemonSets, &inv.replicaSets,
+		&inv.cronJobs, &inv.jobs, &inv.pods, &inv.priorityClasses, &inv.nodes}
+	for _, resource := range resources {
+		*resource = inventoryResource{{
+			namespace: metav1.NamespaceAll,
+			indexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}),
+		}}
+	}
+	for _, obj := range objects {
+		var resource inventoryResource
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			resource = inv.deployments
+		case *appsv1.StatefulSet:
+			resource = inv.statefulSets
+		case *appsv1.DaemonSet:
+			resource = inv.daemonSets
+		case *appsv1.ReplicaSet:
+			resource = inv.replicaSets
+		case *batchv1.CronJob:
+			resource = inv.cronJobs
+		case *batchv1.Job:
+			resource = inv.jobs
+		case *corev1.Pod:
+			resource = inv.pods
+		case *schedulingv1.PriorityClass:
+			resource = inv.priorityClasses
+		case *corev1.Node:
+			resource = inv.nodes
+		default:
+			t.Fatalf("unsupported inventory object %T", obj)
+		}
+		if err := resource[0].indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := currentInventory
+	t.Cleanup(func() { currentInventory = previous })
+	currentInventory = &inventoryCache{inventory: inv}
+	currentInventory.once.Do(func() {})
+	return inv
+}
+
+func testPod(name string, created time.Time, podLabels map[string]string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "default",
+		Name:              name,
+		Labels:            podLabels,
+		CreationTimestamp: metav1.NewTime(created),
+	}}
+}
+
+// controlledBy sets the controller of the object.
+func controlledBy[T metav1.Object](obj T, controller metav1.Object) T {
+	obj.SetOwnerReferences([]metav1.OwnerReference{
+		{Name: controller.GetName(), UID: controller.GetUID(), Controller: ptr.To(true)},
+	})
+	return obj
+}
+
+func waitingPod(reason string, terminated *corev1.ContainerStateTerminated, logs string) *corev1.Pod {
+	pod := testPod("web-1", time.Now(), nil)
+	pod.Annotations = map[string]string{"logs": logs}
+	pod.Spec.NodeName = "node-a"
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:                 "app",
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "failed"}},
+		LastTerminationState: corev1.ContainerState{Terminated: terminated},
+	}}
+	return pod
+}
+
+func unschedulablePod(since time.Duration) *corev1.Pod {
+	pod := testPod("web-1", time.Now(), nil)
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:               corev1.PodScheduled,
+		Status:             corev1.ConditionFalse,
+		Reason:             corev1.PodReasonUnschedulable,
+		Message:            "0/3 nodes are available",
+		LastTransitionTime: metav1.NewTime(time.Now().Add(-since)),
+	}}
+	return pod
+}
+
+func TestUnhealthyPodReason(t *testing.T) {
+	archReason := "container app: exec format error, the image does not support the architecture of node node-a"
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want string
+	}{
+		{name: "running", pod: testPod("web-1", time.Now(), nil)},
+		{name: "creating", pod: waitingPod("ContainerCreating", nil, "")},
+		{name: "pull retried", pod: waitingPod("ErrImagePull", nil, "")},
+		{name: "pull backoff", pod: waitingPod("ImagePullBackOff", nil, ""),
+			want: "container app: ImagePullBackOff: failed"},
+		{name: "crash loop", pod: waitingPod("CrashLoopBackOff", nil, "panic: boom"),
+			want: "container app: CrashLoopBackOff"},
+		{name: "exec format error in the termination message", pod: waitingPod("CrashLoopBackOff",
+			&corev1.ContainerStateTerminated{Message: "exec /app: exec format error"}, ""), want: archReason},
+		{name: "exec format error in the logs", pod: waitingPod("CrashLoopBackOff", nil, "exec /app: exec format error"),
+			want: archReason},
+		{name: "unschedulable for a while", pod: unschedulablePod(time.Minute)},
+		{name: "unschedulable too long", pod: unschedulablePod(time.Hour),
+			want: "unschedulable for more than 3m0s: 0/3 nodes are available"},
+	}
+	for _, tt := range tests {
+		testInventory(t, tt.pod)
+		testKubeClient(t, tt.pod)
+		if got := unhealthyPodReason(context.Background(), tt.pod); got != tt.want {
+			t.Errorf("%s: unhealthyPodReason() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGuardRollbackAction(t *testing.T) {
+	tests := []struct {
+		action WorkloadAction
+		want   string
+		ok     bool
+	}{
+		{action: migrateAction, want: rollbackAction.Name, ok: true},
+		{action: armPatchAction, want: armRollbackAction.Name, ok: true},
+		{action: rollbackAction},
+		{action: armRollbackAction},
+		{action: WorkloadAction{Name: "restart"}},
+	}
+	for _, tt := range tests {
+		got, ok := guardRollbackAction(tt.action)
+		if ok != tt.ok || got.Name != tt.want {
+			t.Errorf("guardRollbackAction(%s) = %q, %v, want %q, %v", tt.action.Name, got.Name, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestListRevisionPods(t *testing.T) {
+	patchedAt := time.Now()
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "ds-web"}}
+	ds.Spec.Selector = selector
+	daemonSet := func(templateGeneration string) WorkloadObject {
+		ds := ds.DeepCopy()
+		if templateGeneration != "" {
+			ds.Annotations = map[string]string{appsv1.DeprecatedTemplateGeneration: templateGeneration}
+		}
+		return &daemonSetObject{ds}
+	}
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-rs", UID: "rs-web"},
+		Spec:       appsv1.ReplicaSetSpec{Selector: selector},
+	}
+	generation := func(app, templateGeneration string) map[string]string {
+		return map[string]string{"app": app, daemonSetTemplateGenerationKey: templateGeneration}
+	}
+	web := map[string]string{"app": "web"}
+	testInventory(t,
+		controlledBy(testPod("old", patchedAt.Add(-time.Hour), generation("web", "1")), ds),
+		controlledBy(testPod("new", patchedAt.Add(time.Second), generation("web", "2")), ds),
+		controlledBy(testPod("rs-old", patchedAt.Add(-time.Hour), web), rs),
+		controlledBy(testPod("rs-new", patchedAt.Add(time.Second), web), rs),
+		testPod("other", patchedAt.Add(time.Second), generation("api", "2")),
+	)
+
+	tests := []struct {
+		name      string
+		obj       WorkloadObject
+		want      []string
+		wantKnown bool
+	}{
+		{name: "revision labels", obj: daemonSet("2"), want: []string{"new"}, wantKnown: true},
+		{name: "no pods of the revision yet", obj: daemonSet("3"), wantKnown: true},
+		{name: "revision not known", obj: daemonSet("")},
+		{name: "created after the patch", obj: &replicaSetObject{rs}, want: []string{"rs-new"}, wantKnown: true},
+	}
+	for _, tt := range tests {
+		pods, known, err := listRevisionPods(context.Background(), tt.obj, patchedAt)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var names []string
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		if known != tt.wantKnown || strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: listRevisionPods() = %v, %v, want %v, %v", tt.name, names, known, tt.want, tt.wantKnown)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type rolloutWaitOptions struct {
+	enabled         bool
+	timeout         time.Duration
+	continueOnError bool
+
+	// guard rolls back the workloads whose rollout fails, it implies enabled.
+	guard                bool
+	unschedulableTimeout time.Duration
+}
+
+var rolloutWait = rolloutWaitOptions{timeout: 10 * time.Minute, unschedulableTimeout: 3 * time.Minute}
+
+const rolloutPollInterval = 2 * time.Second
+
+func addRolloutWaitFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&rolloutWait.enabled, "wait", rolloutWait.enabled,
+		"wait for the rollout of every patched workload before patching the next one")
+	fs.DurationVar(&rolloutWait.timeout, "timeout", rolloutWait.timeout,
+		"how long to wait for the rollout of a workload with --wait")
+	fs.BoolVar(&rolloutWait.continueOnError, "continue-on-error", rolloutWait.continueOnError,
+		"continue with the next workloads when a workload fails or its rollout times out")
+	fs.BoolVar(&rolloutWait.guard, "guard", rolloutWait.guard,
+		"wait for the rollout like --wait and roll the patch back when the new pods can not become healthy")
+	fs.DurationVar(&rolloutWait.unschedulableTimeout, "unschedulable-timeout", rolloutWait.unschedulableTimeout,
+		"how long a new pod may stay unschedulable with --guard before the patch is rolled back")
+}
+
+func (o *rolloutWaitOptions) waiting() bool {
+	return o.enabled || o.guard
+}
+
+// waitForRollout polls the workload until it is ready, i.e. the controller has
+// observed the patched generation and all replicas are updated and available.
+// The workloads of the inventory are read from its cache, the custom kinds from
+// the API server. The optional check is called on every poll and stops the wait
+// with its error.
+func waitForRollout(workload *Workload, check func(ctx context.Context, obj WorkloadObject) error) error {
+	if dryRunMode != DryRunNone {
+		return nil
+	}
+	if err := useCluster(workload.Cluster); err != nil {
+		return err
+	}
+	handler, err := getWorkloadKindHandler(workload.Kind)
+	if err != nil {
+		return err
+	}
+	get := handler.Get
+	if cached, ok := handler.(cachedWorkloadGetter); ok {
+		get = func(_ context.Context, namespace, name string) (WorkloadObject, error) {
+			return cached.GetCached(namespace, name)
+		}
+	}
+	if noter, ok := handler.(rolloutNoter); ok {
+		fmt.Printf("Skip waiting for %s %s/%s: %s\n", workload.Kind, workload.Namespace, workload.Name, noter.RolloutNote())
+		return nil
+	}
+
+	fmt.Printf("Waiting for the rollout of %s %s/%s, timeout %s\n", workload.Kind, workload.Namespace,
+		workload.Name, rolloutWait.timeout)
+	start := time.Now()
+	lastProgress := ""
+	skipped := false
+	err = wait.PollUntilContextTimeout(context.Background(), rolloutPollInterval, rolloutWait.timeout, true,
+		func(ctx context.Context) (bool, error) {
+			obj, err := get(ctx, workload.Namespace, workload.Name)
+			if err != nil {
+				fmt.Printf("Failed to get %s %s/%s, retrying: %v\n", workload.Kind, workload.Namespace, workload.Name, err)
+				return false, nil
+			}
+			if obj.GetResourceVersion() == workload.patchedVersion {
+				// The watch has not delivered the patch yet.
+				return false, nil
+			}
+			if noter, ok := obj.(rolloutNoter); ok && noter.RolloutNote() != "" {
+				fmt.Printf("Skip waiting for %s %s/%s: %s\n", workload.Kind, workload.Namespace, workload.Name, noter.RolloutNote())
+				skipped = true
+				return true, nil
+			}
+
+			progress := fmt.Sprintf("%d/%d available", obj.AvailableReplicas(), obj.Replicas())
+			if progress != lastProgress {
+				fmt.Printf("  %s %s/%s: %s (%s)\n", workload.Kind, workload.Namespace, workload.Name, progress,
+					time.Since(start).Round(time.Second))
+				lastProgress = progress
+			}
+			if obj.Ready() {
+				return true, nil
+			}
+			if check != nil {
+				return false, check(ctx, obj)
+			}
+			return false, nil
+		})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("rollout did not complete within %s: %w", rolloutWait.timeout, err)
+	}
+	if err != nil || skipped {
+		return err
+	}
+
+	fmt.Printf("Rollout of %s %s/%s completed in %s\n", workload.Kind, workload.Namespace, workload.Name,
+		time.Since(start).Round(time.Second))
+	return nil
+}
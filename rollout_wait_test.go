@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestWaitForRolloutReadsInventory(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Generation: 2, ResourceVersion: "12"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](1)},
+		Status: appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 1, ReadyReplicas: 1, AvailableReplicas: 1,
+			CurrentReplicas: 1, UpdatedReplicas: 1, CurrentRevision: "web-2", UpdateRevision: "web-2"},
+	}
+	// Without an API server every read must come from the inventory.
+	previousClient := kubeClient
+	kubeClient = nil
+	t.Cleanup(func() { kubeClient = previousClient })
+	testInventory(t, sts)
+	previousTimeout := rolloutWait.timeout
+	rolloutWait.timeout = 100 * time.Millisecond
+	t.Cleanup(func() { rolloutWait.timeout = previousTimeout })
+
+	tests := []struct {
+		name           string
+		patchedVersion string
+		wantErr        bool
+	}{
+		{name: "not patched in this run"},
+		{name: "patch seen by the watch", patchedVersion: "11"},
+		{name: "patch not seen yet", patchedVersion: "12", wantErr: true},
+	}
+	for _, tt := range tests {
+		workload := &Workload{Kind: WorkloadStatefulSet, Namespace: "default", Name: "web", patchedVersion: tt.patchedVersion}
+		if err := waitForRollout(workload, nil); (err != nil) != tt.wantErr {
+			t.Errorf("%s: waitForRollout() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
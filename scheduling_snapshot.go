@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// SchedulingSnapshotAnnotation keeps the scheduling fields of the pod template
+// as they were before the first patch action, so that the rollback restores
+// them exactly instead of removing the patched keys.
+const SchedulingSnapshotAnnotation = "migrate.cloudpilot.ai/original-scheduling"
+
+type schedulingSnapshot struct {
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity    `json:"affinity,omitempty"`
+	// Changes are the scheduling changes applied since the snapshot was taken,
+	// the snapshot is restored when the last of them is rolled back.
+	Changes []string `json:"changes"`
+}
+
+func getSchedulingSnapshot(obj WorkloadObject) (*schedulingSnapshot, error) {
+	value, ok := obj.GetAnnotations()[SchedulingSnapshotAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := &schedulingSnapshot{}
+	if err := json.Unmarshal([]byte(value), snapshot); err != nil {
+		return nil, fmt.Errorf("parse annotation %s: %w", SchedulingSnapshotAnnotation, err)
+	}
+	return snapshot, nil
+}
+
+func setSchedulingSnapshot(obj WorkloadObject, snapshot *schedulingSnapshot) error {
+	annotations := obj.GetAnnotations()
+	if snapshot == nil {
+		delete(annotations, SchedulingSnapshotAnnotation)
+		obj.SetAnnotations(annotations)
+		return nil
+	}
+
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SchedulingSnapshotAnnotation] = string(value)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// applySchedulingChange applies the action to the pod spec and keeps the
+// scheduling snapshot of obj up to date.
+//
+// A patch action takes the snapshot before its first change, unless the change
+// is already in the pod spec without a snapshot, e.g. because it was patched by
+// hand. A rollback action restores the snapshot when it reverts the last
+// recorded change, and falls back to removing the patched keys when no
+// snapshot exists. While other recorded changes have to be kept, the patched
+// keys are removed as well, but the entries of the snapshot are kept.
+func applySchedulingChange(workload *Workload, obj WorkloadObject, podSpec *corev1.PodSpec, action WorkloadAction) error {
+	if action.Scheduling == "" {
+		return action.Mutate(workload, podSpec)
+	}
+
+	snapshot, err := getSchedulingSnapshot(obj)
+	if err != nil {
+		return err
+	}
+
+	if !action.Rollback {
+		if snapshot == nil || !slices.Contains(snapshot.Changes, action.Scheduling) {
+			if action.Applied == nil || !action.Applied(podSpec) {
+				if snapshot == nil {
+					snapshot = &schedulingSnapshot{
+						NodeSelector: podSpec.NodeSelector,
+						Tolerations:  podSpec.Tolerations,
+						Affinity:     podSpec.Affinity,
+					}
+				}
+				snapshot.Changes = append(snapshot.Changes, action.Scheduling)
+				if err := setSchedulingSnapshot(obj, snapshot); err != nil {
+					return err
+				}
+			}
+		}
+		return action.Mutate(workload, podSpec)
+	}
+
+	if snapshot == nil || !slices.Contains(snapshot.Changes, action.Scheduling) {
+		return action.Mutate(workload, podSpec)
+	}
+
+	snapshot.Changes = slices.DeleteFunc(snapshot.Changes, func(change string) bool {
+		return change == action.Scheduling
+	})
+	if len(snapshot.Changes) > 0 {
+		if err := setSchedulingSnapshot(obj, snapshot); err != nil {
+			return err
+		}
+		before := podSpec.DeepCopy()
+		if err := action.Mutate(workload, podSpec); err != nil {
+			return err
+		}
+		keepSnapshotEntries(before, podSpec, snapshot)
+		return nil
+	}
+
+	fmt.Printf("Restore the original scheduling fields of workload %s %s/%s\n",
+		workload.Kind, workload.Namespace, workload.Name)
+	podSpec.NodeSelector = snapshot.NodeSelector
+	podSpec.Tolerations = snapshot.Tolerations
+	podSpec.Affinity = snapshot.Affinity
+	return setSchedulingSnapshot(obj, nil)
+}
+
+// keepSnapshotEntries adds back the entries of the snapshot which the removal
+// of the patched keys dropped, e.g. a toleration with the same key which the
+// workload had before the first patch.
+func keepSnapshotEntries(before, podSpec *corev1.PodSpec, snapshot *schedulingSnapshot) {
+	for key, value := range snapshot.NodeSelector {
+		if _, exists := podSpec.NodeSelector[key]; !exists && before.NodeSelector[key] == value {
+			if podSpec.NodeSelector == nil {
+				podSpec.NodeSelector = map[string]string{}
+			}
+			podSpec.NodeSelector[key] = value
+		}
+	}
+
+	for _, toleration := range snapshot.Tolerations {
+		if containsSemantic(before.Tolerations, toleration) && !containsSemantic(podSpec.Tolerations, toleration) {
+			podSpec.Tolerations = append(podSpec.Tolerations, toleration)
+		}
+	}
+
+	if snapshot.Affinity == nil || snapshot.Affinity.NodeAffinity == nil || before.Affinity == nil || before.Affinity.NodeAffinity == nil {
+		return
+	}
+	for _, term := range snapshot.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if !containsSemantic(before.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, term) {
+			continue
+		}
+		podSpec.Affinity = ensurePreferAffinity(podSpec.Affinity)
+		if !containsSemantic(podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, term) {
+			podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution =
+				append(podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, term)
+		}
+	}
+}
+
+func containsSemantic[T any](items []T, item T) bool {
+	for _, i := range items {
+		if equality.Semantic.DeepEqual(i, item) {
+			return true
+		}
+	}
+	return false
+}
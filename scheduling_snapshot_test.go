@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func snapshotTestDeployment(podSpec corev1.PodSpec) *deploymentObject {
+	return &deploymentObject{&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"},
+		Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}},
+	}}
+}
+
+func TestApplySchedulingChangeRestoresSnapshot(t *testing.T) {
+	original := corev1.PodSpec{
+		NodeSelector: map[string]string{"team": "payments"},
+		Tolerations: []corev1.Toleration{
+			{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "payments", Effect: corev1.TaintEffectNoSchedule},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		actions []WorkloadAction
+	}{
+		{name: "migrate", actions: []WorkloadAction{migrateAction, rollbackAction}},
+		{name: "arm patch", actions: []WorkloadAction{armPatchAction, armRollbackAction}},
+		{name: "nested rollbacks", actions: []WorkloadAction{migrateAction, armPatchAction, armRollbackAction, rollbackAction}},
+		{name: "crossed rollbacks", actions: []WorkloadAction{migrateAction, armPatchAction, rollbackAction, armRollbackAction}},
+		{name: "patched twice", actions: []WorkloadAction{migrateAction, migrateAction, rollbackAction}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := snapshotTestDeployment(*original.DeepCopy())
+			workload := &Workload{Kind: WorkloadDeployment, Namespace: "default", Name: "api"}
+			podSpec := &obj.Spec.Template.Spec
+			for _, action := range tt.actions {
+				if err := applySchedulingChange(workload, obj, podSpec, action); err != nil {
+					t.Fatalf("%s: %v", action.Name, err)
+				}
+			}
+
+			if !equality.Semantic.DeepEqual(*podSpec, original) {
+				t.Errorf("pod spec after the rollback = %+v, want %+v", *podSpec, original)
+			}
+			if _, ok := obj.Annotations[SchedulingSnapshotAnnotation]; ok {
+				t.Errorf("snapshot annotation is kept after the last rollback")
+			}
+		})
+	}
+}
+
+func TestApplySchedulingChangeKeepsOtherChange(t *testing.T) {
+	obj := snapshotTestDeployment(corev1.PodSpec{})
+	workload := &Workload{Kind: WorkloadDeployment, Namespace: "default", Name: "api"}
+	podSpec := &obj.Spec.Template.Spec
+	for _, action := range []WorkloadAction{migrateAction, armPatchAction, rollbackAction} {
+		if err := applySchedulingChange(workload, obj, podSpec, action); err != nil {
+			t.Fatalf("%s: %v", action.Name, err)
+		}
+	}
+
+	if CheckWorkloadIsMigrated(podSpec.NodeSelector, podSpec.Tolerations) {
+		t.Errorf("pod spec is still migrated after the rollback")
+	}
+	if !armPatchAction.Applied(podSpec) {
+		t.Errorf("ARM patch was removed by the rollback of the migration")
+	}
+	snapshot, err := getSchedulingSnapshot(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot == nil || len(snapshot.Changes) != 1 || snapshot.Changes[0] != armPatchAction.Scheduling {
+		t.Errorf("snapshot = %+v, want only the %q change", snapshot, armPatchAction.Scheduling)
+	}
+}
+
+func TestApplySchedulingChangeWithoutSnapshot(t *testing.T) {
+	// Patched by hand: the change is already applied, no snapshot is taken and
+	// the rollback removes the patched keys.
+	obj := snapshotTestDeployment(corev1.PodSpec{})
+	podSpec := &obj.Spec.Template.Spec
+	if err := migratePodSpec(nil, podSpec); err != nil {
+		t.Fatal(err)
+	}
+	workload := &Workload{Kind: WorkloadDeployment, Namespace: "default", Name: "api"}
+
+	if err := applySchedulingChange(workload, obj, podSpec, migrateAction); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obj.Annotations[SchedulingSnapshotAnnotation]; ok {
+		t.Errorf("snapshot taken of an already migrated pod spec")
+	}
+	if err := applySchedulingChange(workload, obj, podSpec, rollbackAction); err != nil {
+		t.Fatal(err)
+	}
+	if CheckWorkloadIsMigrated(podSpec.NodeSelector, podSpec.Tolerations) {
+		t.Errorf("pod spec is still migrated after the rollback")
+	}
+}
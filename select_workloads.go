@@ -4,52 +4,41 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 func selectWorkloads(scanner *bufio.Scanner) ([]Workload, error) {
-	fmt.Println("Input the workload id which should be selected, example: 0,1,2,3; or a range, example 1-9")
+	fmt.Println("Input the workload ids which should be selected, example: 0,1,2,3; ranges and exclusions, example: 1-4,7,9-12,!8")
+	fmt.Println("Or input a selector, example: namespace=payments kind=Deployment arm-supported=true arm-patched=false")
 	fmt.Print("Input: ")
 
 	if !scanner.Scan() {
 		return nil, fmt.Errorf("input nothing")
 	}
-	input := scanner.Text()
-
-	var workloadsIDs []string
-	if strings.Contains(input, "-") {
-		ids := strings.Split(input, "-")
-		startIDStr, endIDStr := ids[0], ids[1]
-
-		startID, err := strconv.Atoi(startIDStr)
-		if err != nil {
-			return nil, err
-		}
-		endID, err := strconv.Atoi(endIDStr)
-		if err != nil {
-			return nil, err
-		}
-		for i := startID; i <= endID; i++ {
-			workloadsIDs = append(workloadsIDs, strconv.Itoa(i))
-		}
-	} else {
-		workloadsIDs = strings.Split(input, ",")
+	input := strings.TrimSpace(scanner.Text())
+	if input == "" {
+		return nil, fmt.Errorf("input nothing")
 	}
 
-	selectedWorkloads := make([]Workload, len(workloadsIDs))
-	for i, id := range workloadsIDs {
-		idInt, err := strconv.Atoi(id)
-		if err != nil {
-			return nil, fmt.Errorf("error converting workload id '%s' to int", id)
-		}
-		if idInt >= len(workloads) {
-			return nil, fmt.Errorf("wrong workload id '%s'", id)
-		}
-		selectedWorkloads[i] = workloads[idInt]
+	if !strings.Contains(input, "=") {
+		input = "ids=" + strings.Join(strings.Fields(input), "")
+	}
+	selector, err := parseSelectorExpression(input)
+	if err != nil {
+		return nil, err
+	}
+	selectedWorkloads, err := selector.Select(workloads)
+	if err != nil {
+		return nil, err
+	}
+	if len(selectedWorkloads) == 0 {
+		return nil, fmt.Errorf("no workload matches the selector")
 	}
 
 	printSelectedWorkloadsTable(selectedWorkloads, "")
@@ -69,18 +58,27 @@ func selectWorkloads(scanner *bufio.Scanner) ([]Workload, error) {
 }
 
 func printSelectedWorkloadsTable(selectedWorkloads []Workload, namespace string) {
+	renderWorkloadsTable(selectedWorkloads, CheckAllWorkloadsArm(selectedWorkloads), namespace, false)
+}
+
+// renderWorkloadsTable prints the workloads table, the wide table adds the
+// readiness and node architectures of the pods, the labels and the errors of
+// the ARM check.
+func renderWorkloadsTable(selectedWorkloads []Workload, armSupported []ArmResult, namespace string, wide bool) {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.SetStyle(table.StyleLight)
 
-	armSupported := CheckAllWorkloadsArm(selectedWorkloads)
-
-	t.AppendHeader(table.Row{"ID", "Namespace", "Kind", "Name", "Replicas", "Available", "Ready",
-		"MigratePatched", "ARMSupported", "ARMPatched", "Priority"})
+	header := table.Row{"ID", "Namespace", "Kind", "Name", "Replicas", "Available", "Ready",
+		"MigratePatched", "ARMSupported", "ARMPatched", "Priority", "LastRun"}
+	if wide {
+		header = append(header, "Pods", "Nodes", "Labels", "ARMError")
+	}
+	t.AppendHeader(insertClusterColumn(header, 1, "Cluster"))
 
 	for id, w := range selectedWorkloads {
 		if namespace == "" || namespace == w.Namespace {
-			t.AppendRow(table.Row{
+			row := table.Row{
 				id,
 				w.Namespace,
 				w.Kind,
@@ -101,13 +99,18 @@ func printSelectedWorkloadsTable(selectedWorkloads []Workload, namespace string)
 				}(),
 				func() interface{} {
 					if armSupported[id].Err != nil {
-						fmt.Printf("Failed to check arm support for workload %s %s/%s: %v",
-							w.Kind, w.Namespace, w.Name, armSupported[id].Err)
+						if !wide {
+							fmt.Printf("Failed to check arm support for workload %s %s/%s: %v\n",
+								w.Kind, w.Namespace, w.Name, armSupported[id].Err)
+						}
 						return text.Colors{text.FgRed}.Sprint("Unknown")
 					}
 					if armSupported[id].Supported {
 						return text.Colors{text.FgGreen}.Sprint("True")
 					}
+					if blockedBy := armSupported[id].BlockedBy(); len(blockedBy) > 0 {
+						return text.Colors{text.FgRed}.Sprintf("False (blocked by: %s)", strings.Join(blockedBy, ", "))
+					}
 					return text.Colors{text.FgRed}.Sprint("False")
 				}(),
 				func() interface{} {
@@ -116,18 +119,44 @@ func printSelectedWorkloadsTable(selectedWorkloads []Workload, namespace string)
 					}
 					return text.Colors{text.FgRed}.Sprint("False")
 				}(),
-				w.Priority,
-			})
+				formatPriority(w),
+				formatLastRun(w),
+			}
+			if wide {
+				row = append(row, formatPodReadiness(w.Pods), formatNodePlacement(w.Pods),
+					labels.FormatLabels(w.Labels), formatARMError(armSupported[id]))
+			}
+			t.AppendRow(insertClusterColumn(row, 1, w.Cluster))
 		}
 	}
 
 	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, AutoMerge: true, Colors: text.Colors{text.FgCyan}},
-		{Number: 2, AutoMerge: true, Colors: text.Colors{text.FgCyan}},
-		{Number: 3, AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "ID", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Cluster", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Namespace", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+		{Name: "Kind", AutoMerge: true, Colors: text.Colors{text.FgCyan}},
 	})
 	t.Style().Options.SeparateRows = true
 
 	t.Render()
 	return
 }
+
+// formatLastRun describes the last scheduled run of a CronJob.
+func formatLastRun(w Workload) string {
+	if w.Kind != WorkloadCronJob {
+		return "-"
+	}
+	if w.LastScheduleTime == nil {
+		return "never"
+	}
+
+	status := text.Colors{text.FgRed}.Sprint("failed")
+	switch {
+	case w.Available > 0:
+		status = text.Colors{text.FgYellow}.Sprint("running")
+	case w.LastSuccessfulTime != nil && !w.LastSuccessfulTime.Before(w.LastScheduleTime):
+		status = text.Colors{text.FgGreen}.Sprint("succeeded")
+	}
+	return fmt.Sprintf("%s ago, %s", duration.HumanDuration(time.Since(w.LastScheduleTime.Time)), status)
+}
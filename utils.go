@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,49 +11,85 @@ import (
 	jsonpatch "gopkg.in/evanphx/json-patch.v4"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 )
 
-func patchResource(ctx context.Context, originalObj, updatedObj interface{}, namespace, name string, kind WorkloadKind) error {
+// patchResource patches the difference of the updated workload and reports
+// whether there was one.
+func patchResource(ctx context.Context, originalObj, updatedObj WorkloadObject, namespace, name string, kind WorkloadKind) (bool, error) {
+	patchBytes, err := createWorkloadPatch(originalObj, updatedObj)
+	if err != nil {
+		return false, err
+	}
+	if isEmptyPatch(patchBytes) {
+		fmt.Printf("Workload %s %s/%s is already up to date\n", kind, namespace, name)
+		return false, nil
+	}
+
+	if dryRunMode != DryRunNone {
+		printPatchPreview(originalObj, updatedObj, namespace, name, kind, patchBytes)
+	}
+	return true, sendWorkloadPatch(ctx, namespace, name, kind, patchBytes)
+}
+
+// createWorkloadPatch returns the JSON merge patch from the original to the
+// updated workload.
+func createWorkloadPatch(originalObj, updatedObj WorkloadObject) ([]byte, error) {
 	originalBytes, err := json.Marshal(originalObj)
 	if err != nil {
-		return fmt.Errorf("marshal original: %w", err)
+		return nil, fmt.Errorf("marshal original: %w", err)
 	}
 	updatedBytes, err := json.Marshal(updatedObj)
 	if err != nil {
-		return fmt.Errorf("marshal updated: %w", err)
+		return nil, fmt.Errorf("marshal updated: %w", err)
 	}
 
 	patchBytes, err := jsonpatch.CreateMergePatch(originalBytes, updatedBytes)
 	if err != nil {
-		return fmt.Errorf("create merge patch: %w", err)
+		return nil, fmt.Errorf("create merge patch: %w", err)
+	}
+	return patchBytes, nil
+}
+
+// sendWorkloadPatch applies the JSON merge patch to the workload, honoring the
+// dry-run mode.
+func sendWorkloadPatch(ctx context.Context, namespace, name string, kind WorkloadKind, patchBytes []byte) error {
+	if dryRunMode == DryRunClient {
+		fmt.Printf("Skipped patching workload %s %s/%s (dry run)\n", kind, namespace, name)
+		return nil
 	}
 
-	switch kind {
-	case WorkloadDeployment:
-		err = backoff.Retry(func() error {
-			_, patchErr := kubeClient.AppsV1().Deployments(namespace).
-				Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{})
-			return patchErr
-		}, DefaultBackoff(ctx))
-	case WorkloadStatefulSet:
-		err = backoff.Retry(func() error {
-			_, patchErr := kubeClient.AppsV1().StatefulSets(namespace).
-				Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{})
-			return patchErr
-		}, DefaultBackoff(ctx))
-	default:
-		return fmt.Errorf("unsupported resource kind: %s", kind)
+	patchOptions := metav1.PatchOptions{}
+	if dryRunMode == DryRunServer {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
 	}
 
+	handler, err := getWorkloadKindHandler(kind)
+	if err != nil {
+		return err
+	}
+	err = backoff.Retry(func() error {
+		return handler.Patch(ctx, namespace, name, patchBytes, patchOptions)
+	}, DefaultBackoff(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to patch %s: %w", kind, err)
 	}
 
+	if dryRunMode == DryRunServer {
+		fmt.Printf("Patched workload %s %s/%s successfully (server dry run)\n", kind, namespace, name)
+		return nil
+	}
 	fmt.Printf("Patched workload %s %s/%s successfully\n", kind, namespace, name)
+	if noter, ok := handler.(rolloutNoter); ok {
+		fmt.Printf("%s %s/%s: %s\n", kind, namespace, name, noter.RolloutNote())
+	}
 	return nil
 }
 
+// isEmptyPatch reports whether the merge patch changes nothing.
+func isEmptyPatch(patch []byte) bool {
+	return string(bytes.TrimSpace(patch)) == "{}"
+}
+
 func DefaultBackoff(ctx context.Context) backoff.BackOffContext {
 	return backoff.WithContext(backoff.WithMaxRetries(backoff.NewConstantBackOff(1*time.Second), 5), ctx)
 }
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// The status of a wave, of a workload of a wave or of a plan item.
+const (
+	itemStatusPending = "pending"
+	itemStatusRunning = "running"
+	itemStatusPatched = "patched"
+	itemStatusDone    = "done"
+	itemStatusFailed  = "failed"
+	itemStatusDrifted = "drifted"
+)
+
+type waveOptions struct {
+	size      string
+	order     string
+	orderFile string
+	pause     bool
+	soak      time.Duration
+	statePath string
+	// resume continues an unfinished plan also when the selection changed.
+	resume bool
+}
+
+var waves = waveOptions{order: "selection", statePath: "migrate-waves.json"}
+
+func addWaveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&waves.size, "wave-size", waves.size,
+		"patch the workloads in waves of N workloads, or of N% of the replicas of the selection, e.g. 5 or 20%")
+	fs.StringVar(&waves.order, "wave-order", waves.order,
+		"order of the workloads in the waves: selection, priority (lowest first) or namespace")
+	fs.StringVar(&waves.orderFile, "wave-order-file", waves.orderFile,
+		"file with one kind/namespace/name or namespace/name per line, the listed workloads are patched first in this order")
+	fs.BoolVar(&waves.pause, "wave-pause", waves.pause, "ask for confirmation before every wave after the first one")
+	fs.DurationVar(&waves.soak, "wave-soak", waves.soak, "time to wait after a healthy wave before the next one")
+	fs.StringVar(&waves.statePath, "wave-state", waves.statePath,
+		"file which records the wave plan and its progress, an unfinished plan of the same selection is resumed")
+	fs.BoolVar(&waves.resume, "wave-resume", waves.resume,
+		"resume the unfinished plan of --wave-state even if the selection differs from the planned workloads")
+}
+
+func (o *waveOptions) enabled() bool {
+	return o.size != ""
+}
+
+// wavePlan is the wave plan stored in the state file.
+type wavePlan struct {
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// CurrentWave is the 1-based number of the wave in progress.
+	CurrentWave int        `json:"currentWave"`
+	Completed   bool       `json:"completed"`
+	Waves       []planWave `json:"waves"`
+}
+
+type planWave struct {
+	Status    string         `json:"status"`
+	Workloads []waveWorkload `json:"workloads"`
+}
+
+type waveWorkload struct {
+	Cluster   string       `json:"cluster,omitempty"`
+	Kind      WorkloadKind `json:"kind"`
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	Replicas  int32        `json:"replicas"`
+	Status    string       `json:"status"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// workloadKey identifies a workload, the cluster is only part of the key with
+// --contexts.
+func workloadKey(cluster string, kind WorkloadKind, namespace, name string) string {
+	key := string(kind) + "/" + namespace + "/" + name
+	if cluster != "" {
+		key = cluster + "/" + key
+	}
+	return key
+}
+
+// applyWorkloadActionInWaves orders the selected workloads and splits them into
+// waves. Every wave is patched, then the tool waits until all its workloads are
+// ready before it soaks or asks for confirmation and continues with the next
+// wave. The progress is recorded in the state file, an unfinished plan of the
+// same action and selection is resumed instead of planning the selection again.
+func applyWorkloadActionInWaves(selectedWorkloads []Workload, action WorkloadAction) error {
+	plan, resumed, err := loadWavePlan(waves.statePath, action, selectedWorkloads)
+	if err != nil {
+		return err
+	}
+	if !resumed {
+		if plan, err = newWavePlan(selectedWorkloads, action); err != nil {
+			return err
+		}
+	}
+	printWavePlan(plan)
+	if resumed {
+		fmt.Printf("Resuming the wave plan of %s at wave %d of %d\n", waves.statePath, plan.CurrentWave, len(plan.Waves))
+	}
+
+	byKey := make(map[string]Workload, len(workloads))
+	for _, w := range workloads {
+		byKey[workloadKey(w.Cluster, w.Kind, w.Namespace, w.Name)] = w
+	}
+
+	total := 0
+	for _, wave := range plan.Waves {
+		total += len(wave.Workloads)
+	}
+
+	// The first wave run by this invocation starts without soak and
+	// confirmation, also when a plan is resumed.
+	started := false
+	failed, skipped := 0, 0
+	for i := range plan.Waves {
+		wave := &plan.Waves[i]
+		if wave.Status == itemStatusDone {
+			continue
+		}
+		if failed > 0 && !rolloutWait.continueOnError {
+			skipped += len(wave.Workloads)
+			continue
+		}
+
+		if started {
+			proceed, err := waitBeforeWave(i + 1)
+			if err != nil {
+				return err
+			}
+			if !proceed {
+				return fmt.Errorf("stopped before wave %d of %d, run the command again to resume", i+1, len(plan.Waves))
+			}
+		}
+		started = true
+
+		plan.CurrentWave = i + 1
+		wave.Status = itemStatusRunning
+		if err := saveWavePlan(waves.statePath, plan); err != nil {
+			return err
+		}
+
+		fmt.Printf("\nStarting wave %d of %d with %d workloads\n", i+1, len(plan.Waves), len(wave.Workloads))
+		waveFailed := runWave(wave, byKey, action)
+		failed += waveFailed
+		wave.Status = itemStatusDone
+		if waveFailed > 0 {
+			wave.Status = itemStatusFailed
+			fmt.Printf("Wave %d failed, %d of %d workloads failed\n", i+1, waveFailed, len(wave.Workloads))
+		}
+		if err := saveWavePlan(waves.statePath, plan); err != nil {
+			return err
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Stopped the waves, skipped %d workloads, run the command again to resume\n", skipped)
+		return &workloadFailures{failed: failed, skipped: skipped, total: total}
+	}
+	plan.Completed = failed == 0
+	if err := saveWavePlan(waves.statePath, plan); err != nil {
+		return err
+	}
+	return newWorkloadFailures(failed, total)
+}
+
+// runWave patches the workloads of the wave which are not done yet, then waits
+// for their rollouts. It returns the number of failed workloads.
+func runWave(wave *planWave, byKey map[string]Workload, action WorkloadAction) int {
+	patchedAt := time.Now()
+	patched := make([]*waveWorkload, 0, len(wave.Workloads))
+	failed := 0
+	fail := func(item *waveWorkload, err error) {
+		fmt.Printf("Failed to %s %s workload %s/%s: %v\n", action.Name, item.Kind, item.Namespace, item.Name, err)
+		item.Status = itemStatusFailed
+		item.Error = err.Error()
+		failed++
+	}
+
+	for j := range wave.Workloads {
+		item := &wave.Workloads[j]
+		if item.Status == itemStatusDone {
+			continue
+		}
+		key := workloadKey(item.Cluster, item.Kind, item.Namespace, item.Name)
+		workload, ok := byKey[key]
+		if !ok {
+			fail(item, errors.New("workload not found"))
+			continue
+		}
+		if err := mutateWorkload(&workload, action); err != nil {
+			fail(item, err)
+			continue
+		}
+		byKey[key] = workload
+		item.Status = itemStatusRunning
+		item.Error = ""
+		patched = append(patched, item)
+	}
+
+	for _, item := range patched {
+		workload := byKey[workloadKey(item.Cluster, item.Kind, item.Namespace, item.Name)]
+		if err := awaitWorkloadRollout(&workload, action, patchedAt); err != nil {
+			fail(item, err)
+			continue
+		}
+		item.Status = itemStatusDone
+	}
+	return failed
+}
+
+// waitBeforeWave soaks and asks for confirmation before the wave.
+func waitBeforeWave(number int) (bool, error) {
+	if waves.soak > 0 && dryRunMode == DryRunNone {
+		fmt.Printf("Soaking for %s before wave %d\n", waves.soak, number)
+		time.Sleep(waves.soak)
+	}
+	if !waves.pause {
+		return true, nil
+	}
+
+	fmt.Printf("Press 'Enter' to start wave %d, or input others to stop: ", number)
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false, scanner.Err()
+	}
+	return scanner.Text() == "", nil
+}
+
+func newWavePlan(selectedWorkloads []Workload, action WorkloadAction) (*wavePlan, error) {
+	ordered, err := orderWaveWorkloads(selectedWorkloads)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := splitWaves(ordered, waves.size)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &wavePlan{Action: action.Name, CreatedAt: time.Now(), CurrentWave: 1}
+	for _, batch := range batches {
+		wave := planWave{Status: itemStatusPending}
+		for _, w := range batch {
+			wave.Workloads = append(wave.Workloads, waveWorkload{
+				Cluster:   w.Cluster,
+				Kind:      w.Kind,
+				Namespace: w.Namespace,
+				Name:      w.Name,
+				Replicas:  w.Replicas,
+				Status:    itemStatusPending,
+			})
+		}
+		plan.Waves = append(plan.Waves, wave)
+	}
+	return plan, nil
+}
+
+func orderWaveWorkloads(selectedWorkloads []Workload) ([]Workload, error) {
+	ordered := slices.Clone(selectedWorkloads)
+	switch waves.order {
+	case "selection":
+	case "priority":
+		// The workloads of unknown priority come last.
+		slices.SortStableFunc(ordered, func(a, b Workload) int {
+			switch {
+			case a.PriorityUnknown && !b.PriorityUnknown:
+				return 1
+			case !a.PriorityUnknown && b.PriorityUnknown:
+				return -1
+			}
+			return cmp.Compare(a.Priority, b.Priority)
+		})
+	case "namespace":
+		slices.SortStableFunc(ordered, func(a, b Workload) int { return strings.Compare(a.Namespace, b.Namespace) })
+	default:
+		return nil, newUsageError(fmt.Errorf("invalid --wave-order %q, must be selection, priority or namespace", waves.order))
+	}
+
+	if waves.orderFile == "" {
+		return ordered, nil
+	}
+	data, err := os.ReadFile(waves.orderFile)
+	if err != nil {
+		return nil, fmt.Errorf("read wave order file: %w", err)
+	}
+	rank := make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, exists := rank[line]; !exists {
+			rank[line] = len(rank)
+		}
+	}
+	position := func(w Workload) int {
+		if r, ok := rank[workloadKey(w.Cluster, w.Kind, w.Namespace, w.Name)]; ok {
+			return r
+		}
+		if r, ok := rank[w.Namespace+"/"+w.Name]; ok {
+			return r
+		}
+		return len(rank)
+	}
+	slices.SortStableFunc(ordered, func(a, b Workload) int { return cmp.Compare(position(a), position(b)) })
+	return ordered, nil
+}
+
+// splitWaves splits the workloads into waves of N workloads, or of at most N%
+// of the replicas of all workloads. Every wave has at least one workload.
+func splitWaves(ordered []Workload, size string) ([][]Workload, error) {
+	if percent, ok := strings.CutSuffix(size, "%"); ok {
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil || value <= 0 || value > 100 {
+			return nil, newUsageError(fmt.Errorf("invalid --wave-size %q, the percentage must be in (0, 100]", size))
+		}
+		var total int64
+		for _, w := range ordered {
+			total += int64(w.Replicas)
+		}
+		budget := max(1, int64(math.Ceil(float64(total)*value/100)))
+
+		var batches [][]Workload
+		var batch []Workload
+		var replicas int64
+		for _, w := range ordered {
+			if len(batch) > 0 && replicas+int64(w.Replicas) > budget {
+				batches = append(batches, batch)
+				batch, replicas = nil, 0
+			}
+			batch = append(batch, w)
+			replicas += int64(w.Replicas)
+		}
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+		return batches, nil
+	}
+
+	count, err := strconv.Atoi(size)
+	if err != nil || count <= 0 {
+		return nil, newUsageError(fmt.Errorf("invalid --wave-size %q, must be a positive number or a percentage", size))
+	}
+	var batches [][]Workload
+	for chunk := range slices.Chunk(ordered, count) {
+		batches = append(batches, chunk)
+	}
+	return batches, nil
+}
+
+// loadWavePlan loads the unfinished plan of the action from the state file. A
+// plan of other workloads than the selection is only resumed with
+// --wave-resume, it could be an old plan of another scope.
+func loadWavePlan(path string, action WorkloadAction, selectedWorkloads []Workload) (*wavePlan, bool, error) {
+	if path == "" {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read wave state: %w", err)
+	}
+
+	plan := &wavePlan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, false, fmt.Errorf("parse wave state %s: %w", path, err)
+	}
+	if plan.Completed {
+		return nil, false, nil
+	}
+	if plan.Action != action.Name {
+		return nil, false, fmt.Errorf("wave state %s belongs to an unfinished %q plan, finish it or remove the file",
+			path, plan.Action)
+	}
+	if !waves.resume && !plan.plans(selectedWorkloads) {
+		return nil, false, fmt.Errorf("wave state %s belongs to an unfinished plan of other workloads than the selection, "+
+			"resume it with --wave-resume or remove the file", path)
+	}
+	return plan, true, nil
+}
+
+// plans reports whether the plan contains exactly the workloads.
+func (p *wavePlan) plans(workloads []Workload) bool {
+	planned := make(map[string]bool)
+	for _, wave := range p.Waves {
+		for _, item := range wave.Workloads {
+			planned[workloadKey(item.Cluster, item.Kind, item.Namespace, item.Name)] = true
+		}
+	}
+	selected := make(map[string]bool, len(workloads))
+	for _, w := range workloads {
+		selected[workloadKey(w.Cluster, w.Kind, w.Namespace, w.Name)] = true
+	}
+	return maps.Equal(planned, selected)
+}
+
+func saveWavePlan(path string, plan *wavePlan) error {
+	if path == "" || dryRunMode != DryRunNone {
+		return nil
+	}
+	plan.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write wave state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func printWavePlan(plan *wavePlan) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(insertClusterColumn(table.Row{"Wave", "Namespace", "Kind", "Name", "Replicas", "Status"}, 1, "Cluster"))
+
+	for i, wave := range plan.Waves {
+		for _, item := range wave.Workloads {
+			t.AppendRow(insertClusterColumn(table.Row{
+				fmt.Sprintf("%d (%s)", i+1, wave.Status),
+				item.Namespace,
+				item.Kind,
+				item.Name,
+				item.Replicas,
+				formatItemStatus(item.Status),
+			}, 1, item.Cluster))
+		}
+	}
+
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, AutoMerge: true, Colors: text.Colors{text.FgCyan}},
+	})
+	t.Style().Options.SeparateRows = true
+	t.Render()
+}
+
+func formatItemStatus(status string) string {
+	switch status {
+	case itemStatusDone:
+		return text.Colors{text.FgGreen}.Sprint(status)
+	case itemStatusFailed, itemStatusDrifted:
+		return text.Colors{text.FgRed}.Sprint(status)
+	case itemStatusRunning, itemStatusPatched:
+		return text.Colors{text.FgYellow}.Sprint(status)
+	}
+	return status
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func replicaWorkloads(replicas ...int32) []Workload {
+	var workloads []Workload
+	for i, r := range replicas {
+		workloads = append(workloads, Workload{Kind: WorkloadDeployment, Namespace: "default",
+			Name: string(rune('a' + i)), Replicas: r})
+	}
+	return workloads
+}
+
+func waveReplicas(batches [][]Workload) [][]int32 {
+	var result [][]int32
+	for _, batch := range batches {
+		var replicas []int32
+		for _, w := range batch {
+			replicas = append(replicas, w.Replicas)
+		}
+		result = append(result, replicas)
+	}
+	return result
+}
+
+func TestSplitWaves(t *testing.T) {
+	tests := []struct {
+		name      string
+		workloads []Workload
+		size      string
+		want      [][]int32
+		wantErr   bool
+	}{
+		{name: "count", workloads: replicaWorkloads(1, 2, 3, 4, 5), size: "2", want: [][]int32{{1, 2}, {3, 4}, {5}}},
+		{name: "count larger than selection", workloads: replicaWorkloads(1, 2), size: "5", want: [][]int32{{1, 2}}},
+		{name: "percentage of replicas", workloads: replicaWorkloads(2, 2, 3, 1, 2), size: "40%",
+			want: [][]int32{{2, 2}, {3, 1}, {2}}},
+		{name: "workload larger than the budget", workloads: replicaWorkloads(1, 8, 1), size: "20%",
+			want: [][]int32{{1}, {8}, {1}}},
+		{name: "budget of at least one replica", workloads: replicaWorkloads(0, 0, 1), size: "1%",
+			want: [][]int32{{0, 0, 1}}},
+		{name: "all replicas", workloads: replicaWorkloads(3, 4), size: "100%", want: [][]int32{{3, 4}}},
+		{name: "zero count", workloads: replicaWorkloads(1), size: "0", wantErr: true},
+		{name: "not a number", workloads: replicaWorkloads(1), size: "abc", wantErr: true},
+		{name: "percentage above 100", workloads: replicaWorkloads(1), size: "150%", wantErr: true},
+		{name: "zero percentage", workloads: replicaWorkloads(1), size: "0%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches, err := splitWaves(tt.workloads, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitWaves(%q) error = %v, want error %v", tt.size, err, tt.wantErr)
+			}
+			if got := waveReplicas(batches); !tt.wantErr && !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("splitWaves(%q) = %v, want %v", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWavePlanPlans(t *testing.T) {
+	defer func(options waveOptions) { waves = options }(waves)
+	waves.size, waves.order = "2", "selection"
+
+	workloads := replicaWorkloads(1, 2, 3)
+	plan, err := newWavePlan(workloads, migrateAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		selection []Workload
+		want      bool
+	}{
+		{name: "same selection", selection: workloads, want: true},
+		{name: "other order", selection: []Workload{workloads[2], workloads[0], workloads[1]}, want: true},
+		{name: "fewer workloads", selection: workloads[:2], want: false},
+		{name: "other workloads", selection: replicaWorkloads(1, 2, 3, 4), want: false},
+	}
+	for _, tt := range tests {
+		if got := plan.plans(tt.selection); got != tt.want {
+			t.Errorf("%s: plans() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
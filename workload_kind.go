@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// WorkloadObject gives kind-agnostic access to a workload object. It is
+// marshalled to JSON to compute the merge patch, so implementations must
+// marshal to the object as the API server returns it.
+type WorkloadObject interface {
+	metav1.Object
+
+	// PodTemplate returns the pod template of the workload. Changes to the
+	// returned template are only guaranteed to apply after SetPodTemplate.
+	PodTemplate() (*corev1.PodTemplateSpec, error)
+	SetPodTemplate(template *corev1.PodTemplateSpec) error
+	Selector() *metav1.LabelSelector
+	Replicas() int32
+	AvailableReplicas() int32
+	Ready() bool
+	DeepCopyWorkload() WorkloadObject
+}
+
+// WorkloadKindHandler lists, gets and patches the workloads of one kind.
+type WorkloadKindHandler interface {
+	Kind() WorkloadKind
+	// List returns the workloads of the kind in the namespace, workloads which
+	// are managed through another workload, like the ReplicaSets of a
+	// Deployment, must be skipped.
+	List(ctx context.Context, namespace string) ([]WorkloadObject, error)
+	Get(ctx context.Context, namespace, name string) (WorkloadObject, error)
+	// Patch applies a JSON merge patch to the workload.
+	Patch(ctx context.Context, namespace, name string, patch []byte, opts metav1.PatchOptions) error
+}
+
+// rolloutNoter is implemented by the handlers of the kinds which do not roll
+// out a changed pod template to the running pods, and by the objects which
+// depend on their spec, with an empty note when they do roll out.
+type rolloutNoter interface {
+	RolloutNote() string
+}
+
+// cachedWorkloadGetter is implemented by the kinds of the inventory, their
+// workloads are read from the cache instead of the API server.
+type cachedWorkloadGetter interface {
+	GetCached(namespace, name string) (WorkloadObject, error)
+}
+
+// scheduledWorkload is implemented by the workloads which run on a schedule.
+type scheduledWorkload interface {
+	LastScheduleTime() *metav1.Time
+	LastSuccessfulTime() *metav1.Time
+}
+
+// revisionPodSelector is implemented by the workloads whose controllers label
+// the pods of the current pod template revision. The selector is not known
+// until the controller has observed the latest generation.
+type revisionPodSelector interface {
+	RevisionPodSelector(ctx context.Context) (selector labels.Selector, known bool, err error)
+}
+
+// podOwnerLister is implemented by the workloads whose pods are controlled by
+// the objects they create, like the ReplicaSets of a Deployment or the Jobs of
+// a CronJob.
+type podOwnerLister interface {
+	PodOwners(ctx context.Context) ([]types.UID, error)
+}
+
+var workloadKindHandlers = make(map[WorkloadKind]WorkloadKindHandler)
+
+// workloadKindOrder keeps the registration order, so the workloads are always
+// listed in the same order.
+var workloadKindOrder []WorkloadKind
+
+// RegisterWorkloadKind makes a workload kind available to the listing, the ARM
+// check and all patch actions. It is called from the init functions of the
+// built-in kinds and for the custom kinds of the config file, see
+// registerCustomWorkloads. Registering a kind twice replaces the handler.
+func RegisterWorkloadKind(handler WorkloadKindHandler) {
+	kind := handler.Kind()
+	if _, exists := workloadKindHandlers[kind]; !exists {
+		workloadKindOrder = append(workloadKindOrder, kind)
+	}
+	workloadKindHandlers[kind] = handler
+}
+
+func getWorkloadKindHandler(kind WorkloadKind) (WorkloadKindHandler, error) {
+	handler, ok := workloadKindHandlers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported resource kind: %s", kind)
+	}
+	return handler, nil
+}
+
+func newWorkload(kind WorkloadKind, obj WorkloadObject) (Workload, error) {
+	template, err := obj.PodTemplate()
+	if err != nil {
+		return Workload{}, fmt.Errorf("get pod template of %s %s/%s: %w", kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+	podSpec := template.Spec
+
+	w := Workload{
+		Cluster:        currentCluster,
+		Name:           obj.GetName(),
+		Namespace:      obj.GetNamespace(),
+		Kind:           kind,
+		Labels:         obj.GetLabels(),
+		Replicas:       obj.Replicas(),
+		Available:      obj.AvailableReplicas(),
+		Ready:          obj.Ready(),
+		MigratePatched: CheckWorkloadIsMigrated(podSpec.NodeSelector, podSpec.Tolerations),
+		ARMPatched:     HasArm64Preference(podSpec.Affinity) || CheckWorkloadHasARM64Toleration(podSpec.Tolerations),
+		object:         obj,
+	}
+	pods, err := getWorkloadPods(context.TODO(), obj)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get pods for %s %s/%s, err: %v\n", kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+	var known bool
+	w.Priority, known, w.PodPriorities = getWorkloadPriority(&podSpec, pods)
+	w.PriorityUnknown = !known
+	w.Pods = newWorkloadPods(pods)
+	if scheduled, ok := obj.(scheduledWorkload); ok {
+		w.LastScheduleTime = scheduled.LastScheduleTime()
+		w.LastSuccessfulTime = scheduled.LastSuccessfulTime()
+	}
+	return w, nil
+}
+
+// PodSpecMutation changes the pod spec of a workload for an action.
+type PodSpecMutation func(workload *Workload, podSpec *corev1.PodSpec) error
+
+// WorkloadAction is a change of the pod spec applied to the selected workloads.
+type WorkloadAction struct {
+	// Name is used in the messages, e.g. "migrate".
+	Name   string
+	Mutate PodSpecMutation
+
+	// Scheduling names the scheduling change of the action in the snapshot of
+	// the original scheduling fields, the patch action and its rollback action
+	// use the same name. Actions without a name do not use the snapshot.
+	Scheduling string
+	// Rollback marks the action which reverts the scheduling change, it
+	// restores the snapshot when no other change is left.
+	Rollback bool
+	// Applied reports whether the scheduling change is already in the pod spec,
+	// it is only needed by the patch actions.
+	Applied func(podSpec *corev1.PodSpec) bool
+}
+
+// applyWorkloadAction runs the action on every selected workload and reports
+// how many of them failed. With --wave-size the workloads are patched in waves,
+// see applyWorkloadActionInWaves. With --wait or --guard the rollout of every workload
+// must complete before the next one is patched, the first failure stops the
+// batch unless --continue-on-error is set.
+func applyWorkloadAction(selectedWorkloads []Workload, action WorkloadAction) error {
+	if waves.enabled() {
+		return applyWorkloadActionInWaves(selectedWorkloads, action)
+	}
+
+	failed := 0
+	for i, workload := range selectedWorkloads {
+		err := runWorkloadAction(&workload, action)
+		if err == nil {
+			continue
+		}
+
+		fmt.Printf("Failed to %s %s workload %s/%s: %v\n", action.Name, workload.Kind,
+			workload.Namespace, workload.Name, err)
+		failed++
+		if rolloutWait.waiting() && !rolloutWait.continueOnError {
+			skipped := len(selectedWorkloads) - i - 1
+			if skipped > 0 {
+				fmt.Printf("Stop the batch, skip the remaining %d workloads\n", skipped)
+			}
+			return &workloadFailures{failed: failed, skipped: skipped, total: len(selectedWorkloads)}
+		}
+	}
+	return newWorkloadFailures(failed, len(selectedWorkloads))
+}
+
+// runWorkloadAction patches the workload and waits for its rollout if asked
+// to.
+func runWorkloadAction(workload *Workload, action WorkloadAction) error {
+	patchedAt := time.Now()
+	if err := mutateWorkload(workload, action); err != nil {
+		return err
+	}
+	if !rolloutWait.waiting() {
+		return nil
+	}
+	return awaitWorkloadRollout(workload, action, patchedAt)
+}
+
+// awaitWorkloadRollout waits for the rollout of the patched workload. With
+// --guard a patch whose rollout fails is reverted by the matching rollback
+// action.
+func awaitWorkloadRollout(workload *Workload, action WorkloadAction, patchedAt time.Time) error {
+	rollback, guarded := guardRollbackAction(action)
+	if !rolloutWait.guard || !guarded {
+		return waitForRollout(workload, nil)
+	}
+	guard := &rolloutGuard{since: patchedAt}
+	err := waitForRollout(workload, guard.check)
+	if err == nil {
+		return nil
+	}
+
+	fmt.Printf("Rollout of %s %s/%s failed, rolling back: %v\n", workload.Kind, workload.Namespace, workload.Name, err)
+	if rollbackErr := mutateWorkload(workload, rollback); rollbackErr != nil {
+		return fmt.Errorf("%w, rollback failed: %v", err, rollbackErr)
+	}
+	return fmt.Errorf("rolled back: %w", err)
+}
+
+// mutateWorkload gets the latest version of the workload, applies the action
+// to a copy of its pod spec and patches the difference.
+func mutateWorkload(workload *Workload, action WorkloadAction) error {
+	ctx := context.Background()
+	obj, newObj, err := prepareWorkloadChange(ctx, workload, action)
+	if err != nil {
+		return err
+	}
+	patched, err := patchResource(ctx, obj, newObj, workload.Namespace, workload.Name, workload.Kind)
+	if err != nil {
+		return err
+	}
+	if patched {
+		workload.patchedVersion = obj.GetResourceVersion()
+	}
+	return nil
+}
+
+// prepareWorkloadChange gets the latest version of the workload and returns it
+// together with the copy changed by the action.
+func prepareWorkloadChange(ctx context.Context, workload *Workload, action WorkloadAction) (WorkloadObject, WorkloadObject, error) {
+	if err := useCluster(workload.Cluster); err != nil {
+		return nil, nil, err
+	}
+	handler, err := getWorkloadKindHandler(workload.Kind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := handler.Get(ctx, workload.Namespace, workload.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get %s: %w", strings.ToLower(string(workload.Kind)), err)
+	}
+
+	newObj := obj.DeepCopyWorkload()
+	template, err := newObj.PodTemplate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applySchedulingChange(workload, newObj, &template.Spec, action); err != nil {
+		return nil, nil, err
+	}
+	if err := newObj.SetPodTemplate(template); err != nil {
+		return nil, nil, err
+	}
+	return obj, newObj, nil
+}
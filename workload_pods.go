@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// WorkloadPod is a pod of a workload with its readiness and the node it runs
+// on.
+type WorkloadPod struct {
+	Name string `json:"name"`
+	Node string `json:"node,omitempty"`
+	// Arch is the kubernetes.io/arch label of the node.
+	Arch  string `json:"arch,omitempty"`
+	Ready bool   `json:"ready"`
+	// Reason explains why the pod is not ready, e.g. CrashLoopBackOff.
+	Reason string `json:"reason,omitempty"`
+}
+
+// getWorkloadPods returns the pods matching the selector of the workload which
+// are controlled by the workload, directly or through the objects it creates,
+// like the ReplicaSets of a Deployment.
+func getWorkloadPods(ctx context.Context, obj WorkloadObject) ([]corev1.Pod, error) {
+	owners := map[types.UID]bool{obj.GetUID(): true}
+	if lister, ok := obj.(podOwnerLister); ok {
+		uids, err := lister.PodOwners(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			owners[uid] = true
+		}
+	}
+
+	// The pods are matched by their owner, the selector only narrows the list.
+	selector := labels.Everything()
+	if obj.Selector() != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(obj.Selector()); err != nil {
+			return nil, err
+		}
+	}
+	inv, err := getInventory()
+	if err != nil {
+		return nil, err
+	}
+	list, err := listCached[*corev1.Pod](inv.pods, obj.GetNamespace(), selector)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]corev1.Pod, 0, len(list))
+	for _, pod := range list {
+		if owner := metav1.GetControllerOf(pod); owner != nil && owners[owner.UID] {
+			pods = append(pods, *pod)
+		}
+	}
+	return pods, nil
+}
+
+// newWorkloadPods returns the readiness and placement of the pods.
+func newWorkloadPods(pods []corev1.Pod) []WorkloadPod {
+	result := make([]WorkloadPod, 0, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		ready := isPodReady(pod)
+		p := WorkloadPod{Name: pod.Name, Node: pod.Spec.NodeName, Ready: ready}
+		if p.Node != "" {
+			p.Arch = nodeArch(p.Node)
+		}
+		if !ready {
+			p.Reason = podNotReadyReason(pod)
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podNotReadyReason returns the most specific reason why the pod is not ready.
+func podNotReadyReason(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return "Completed"
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason != "" {
+			return cond.Reason
+		}
+	}
+	statuses := append(slices.Clone(pod.Status.InitContainerStatuses), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 && status.State.Terminated.Reason != "" {
+			return status.State.Terminated.Reason
+		}
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return string(pod.Status.Phase)
+	}
+	return "NotReady"
+}
+
+// formatPodReadiness describes the pods of the workload, e.g.
+// "2/3 ready, CrashLoopBackOff: 1".
+func formatPodReadiness(pods []WorkloadPod) string {
+	ready := 0
+	reasons := make(map[string]int)
+	for _, pod := range pods {
+		if pod.Ready {
+			ready++
+		} else {
+			reasons[pod.Reason]++
+		}
+	}
+	readiness := fmt.Sprintf("%d/%d ready", ready, len(pods))
+	if len(reasons) > 0 {
+		readiness += ", " + formatCounts(reasons)
+	}
+	return readiness
+}
+
+// formatNodePlacement counts the pods per architecture of their nodes, e.g.
+// "amd64: 2, arm64: 1".
+func formatNodePlacement(pods []WorkloadPod) string {
+	archs := make(map[string]int)
+	for _, pod := range pods {
+		switch {
+		case pod.Node == "":
+			archs["unscheduled"]++
+		case pod.Arch == "":
+			archs["unknown"]++
+		default:
+			archs[pod.Arch]++
+		}
+	}
+	return formatCounts(archs)
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nodeArch returns the kubernetes.io/arch label of the node, empty when the
+// node is not known.
+func nodeArch(name string) string {
+	inv, err := getInventory()
+	if err != nil || inv.nodes == nil {
+		return ""
+	}
+	node, ok := getCached[*corev1.Node](inv.nodes, name)
+	if !ok {
+		return ""
+	}
+	return node.Labels[corev1.LabelArchStable]
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetWorkloadPods(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	selector := &metav1.LabelSelector{MatchLabels: web}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "deploy-web"},
+		Spec:       appsv1.DeploymentSpec{Selector: selector},
+	}
+	// Another Deployment with an overlapping selector.
+	canary := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "canary", UID: "deploy-canary"}}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "sts-web"},
+		Spec:       appsv1.StatefulSetSpec{Selector: selector},
+	}
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "report", UID: "cron-report"}}
+	rollout := &customWorkloadObject{
+		Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"namespace": "default", "name": "web", "uid": "rollout-web"},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+			},
+		}},
+		handler: &customWorkloadHandler{selectorPath: []string{"spec", "selector"}},
+	}
+
+	rs := testReplicaSet("web-1", web, deployment)
+	canaryRS := testReplicaSet("web-canary-1", web, canary)
+	rolloutRS := testReplicaSet("web-2", web, rollout)
+	job := controlledBy(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "report-1", UID: "job-report"}},
+		cronJob)
+	testInventory(t, rs, canaryRS, rolloutRS, job,
+		controlledBy(testPod("web-1-a", time.Now(), web), rs),
+		controlledBy(testPod("web-canary-1-a", time.Now(), web), canaryRS),
+		controlledBy(testPod("web-2-a", time.Now(), web), rolloutRS),
+		controlledBy(testPod("web-0", time.Now(), web), statefulSet),
+		controlledBy(testPod("report-1-a", time.Now(), nil), job),
+		testPod("web-debug", time.Now(), web),
+	)
+
+	tests := []struct {
+		name string
+		obj  WorkloadObject
+		want []string
+	}{
+		{name: "deployment through its ReplicaSets", obj: &deploymentObject{deployment}, want: []string{"web-1-a"}},
+		{name: "statefulset", obj: &statefulSetObject{statefulSet}, want: []string{"web-0"}},
+		{name: "cronjob through its jobs", obj: &cronJobObject{cronJob}, want: []string{"report-1-a"}},
+		{name: "custom workload through its ReplicaSets", obj: rollout, want: []string{"web-2-a"}},
+	}
+	for _, tt := range tests {
+		pods, err := getWorkloadPods(context.Background(), tt.obj)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var names []string
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: getWorkloadPods() = %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func testReplicaSet(name string, rsLabels map[string]string, owner metav1.Object) *appsv1.ReplicaSet {
+	return controlledBy(&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      name,
+		UID:       types.UID("rs-" + name),
+		Labels:    rsLabels,
+	}}, owner)
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// WorkloadSelector selects workloads by their attributes instead of the row
+// IDs of the workloads table, which shift every time the table is re-listed.
+type WorkloadSelector struct {
+	IDs            string
+	Clusters       patternList
+	Namespaces     patternList
+	Kinds          patternList
+	Names          patternList
+	NameRegex      *regexp.Regexp
+	Labels         labels.Selector
+	MinPriority    *int32
+	MaxPriority    *int32
+	MigratePatched *bool
+	ARMPatched     *bool
+	ARMSupported   *bool
+}
+
+// selectorKeys are the keys accepted in a selector expression, they are also
+// registered as flags of the non-interactive commands.
+var selectorKeys = []struct {
+	key   string
+	usage string
+}{
+	{"ids", "workload ids of the last listed table, e.g. 1-4,7,9-12,!8"},
+	{"cluster", "comma separated kubeconfig contexts of --contexts, globs and !exclusions are supported, e.g. prod-*"},
+	{"namespace", "comma separated namespaces, globs and !exclusions are supported, e.g. payments,team-*,!kube-system"},
+	{"kind", "comma separated kinds, e.g. Deployment,StatefulSet"},
+	{"name", "comma separated workload names, globs and !exclusions are supported, e.g. api-*,!api-canary"},
+	{"name-regex", "regular expression the workload name must match"},
+	{"selector", "kubernetes label selector on the workload labels, e.g. app=web,tier!=db"},
+	{"priority", "priority range min..max, either side may be omitted, e.g. 1000.. or ..0"},
+	{"migrate-patched", "select workloads by the MigratePatched column, true or false"},
+	{"arm-patched", "select workloads by the ARMPatched column, true or false"},
+	{"arm-supported", "select workloads by the ARMSupported column, true or false"},
+}
+
+func addSelectorFlags(fs *flag.FlagSet) map[string]*string {
+	values := make(map[string]*string, len(selectorKeys))
+	for _, k := range selectorKeys {
+		values[k.key] = new(string)
+		fs.StringVar(values[k.key], k.key, "", k.usage)
+	}
+	return values
+}
+
+// parseSelectorExpression parses a whitespace separated list of key=value
+// terms, e.g. "namespace=payments kind=Deployment arm-supported=true".
+func parseSelectorExpression(expr string) (*WorkloadSelector, error) {
+	values := make(map[string]string)
+	for _, term := range strings.Fields(expr) {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid selector term '%s', expected key=value", term)
+		}
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("duplicated selector key '%s'", key)
+		}
+		values[key] = value
+	}
+	return newWorkloadSelector(values)
+}
+
+func newWorkloadSelector(values map[string]string) (*WorkloadSelector, error) {
+	s := &WorkloadSelector{}
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "ids":
+			_, err = parseIDExpression(value, -1)
+			s.IDs = value
+		case "cluster":
+			s.Clusters, err = parsePatternList(value)
+		case "namespace":
+			s.Namespaces, err = parsePatternList(value)
+		case "kind":
+			s.Kinds, err = parsePatternList(value)
+		case "name":
+			s.Names, err = parsePatternList(value)
+		case "name-regex":
+			s.NameRegex, err = regexp.Compile(value)
+		case "selector":
+			s.Labels, err = labels.Parse(value)
+		case "priority":
+			s.MinPriority, s.MaxPriority, err = parsePriorityRange(value)
+		case "migrate-patched":
+			s.MigratePatched, err = parseOptionalBool(value)
+		case "arm-patched":
+			s.ARMPatched, err = parseOptionalBool(value)
+		case "arm-supported":
+			s.ARMSupported, err = parseOptionalBool(value)
+		default:
+			err = fmt.Errorf("unknown selector key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %s=%s: %w", key, value, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *WorkloadSelector) IsEmpty() bool {
+	return s.IDs == "" && len(s.Clusters) == 0 && len(s.Namespaces) == 0 && len(s.Kinds) == 0 && len(s.Names) == 0 &&
+		s.NameRegex == nil && s.Labels == nil && s.MinPriority == nil && s.MaxPriority == nil &&
+		s.MigratePatched == nil && s.ARMPatched == nil && s.ARMSupported == nil
+}
+
+// Select returns the candidates matching the selector. IDs refer to the index
+// of a workload in candidates.
+func (s *WorkloadSelector) Select(candidates []Workload) ([]Workload, error) {
+	ids := make([]int, 0, len(candidates))
+	if s.IDs != "" {
+		var err error
+		ids, err = parseIDExpression(s.IDs, len(candidates))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for i := range candidates {
+			ids = append(ids, i)
+		}
+	}
+
+	var selected []Workload
+	for _, id := range ids {
+		if s.matches(candidates[id]) {
+			selected = append(selected, candidates[id])
+		}
+	}
+
+	// Checking the images is expensive, so only the already filtered workloads are checked.
+	if s.ARMSupported != nil {
+		filtered := selected[:0]
+		for i, result := range CheckAllWorkloadsArm(selected) {
+			if result.Err == nil && result.Supported == *s.ARMSupported {
+				filtered = append(filtered, selected[i])
+			}
+		}
+		selected = filtered
+	}
+	return selected, nil
+}
+
+func (s *WorkloadSelector) matches(w Workload) bool {
+	if !s.Clusters.matches(w.Cluster) || !s.Namespaces.matches(w.Namespace) || !s.Kinds.matches(string(w.Kind)) || !s.Names.matches(w.Name) {
+		return false
+	}
+	if s.NameRegex != nil && !s.NameRegex.MatchString(w.Name) {
+		return false
+	}
+	if s.Labels != nil && !s.Labels.Matches(labels.Set(w.Labels)) {
+		return false
+	}
+	if (s.MinPriority != nil || s.MaxPriority != nil) && w.PriorityUnknown {
+		return false
+	}
+	if s.MinPriority != nil && w.Priority < *s.MinPriority {
+		return false
+	}
+	if s.MaxPriority != nil && w.Priority > *s.MaxPriority {
+		return false
+	}
+	if s.MigratePatched != nil && w.MigratePatched != *s.MigratePatched {
+		return false
+	}
+	if s.ARMPatched != nil && w.ARMPatched != *s.ARMPatched {
+		return false
+	}
+	return true
+}
+
+// patternList is a comma separated list of case-insensitive glob patterns,
+// patterns prefixed with '!' exclude the matching values.
+type patternList []string
+
+func parsePatternList(value string) (patternList, error) {
+	var patterns patternList
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" || p == "!" {
+			continue
+		}
+		if _, err := path.Match(strings.TrimPrefix(p, "!"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", p, err)
+		}
+		patterns = append(patterns, strings.ToLower(p))
+	}
+	return patterns, nil
+}
+
+// names returns the values the list is limited to, it is false when a pattern
+// includes values by a glob or the list only excludes values.
+func (l patternList) names() ([]string, bool) {
+	var names []string
+	for _, p := range l {
+		if strings.HasPrefix(p, "!") {
+			continue
+		}
+		if strings.ContainsAny(p, `*?[\`) {
+			return nil, false
+		}
+		names = append(names, p)
+	}
+	return names, len(names) > 0
+}
+
+func (l patternList) matches(value string) bool {
+	if len(l) == 0 {
+		return true
+	}
+
+	value = strings.ToLower(value)
+	included, hasInclude := false, false
+	for _, p := range l {
+		if exclude, ok := strings.CutPrefix(p, "!"); ok {
+			if matched, _ := path.Match(exclude, value); matched {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if matched, _ := path.Match(p, value); matched {
+			included = true
+		}
+	}
+	return included || !hasInclude
+}
+
+// parseIDExpression parses a list of IDs and ID ranges like "1-4,7,9-12".
+// Terms prefixed with '!' are excluded; an expression with only exclusions
+// starts from all IDs. A negative max only validates the syntax of the
+// expression, it neither checks the bounds nor returns the IDs.
+func parseIDExpression(expr string, max int) ([]int, error) {
+	included := make(map[int]bool)
+	excluded := make(map[int]bool)
+	hasInclude := false
+
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		target := included
+		if t, ok := strings.CutPrefix(term, "!"); ok {
+			target, term = excluded, t
+		} else {
+			hasInclude = true
+		}
+
+		start, end, err := parseIDRange(term)
+		if err != nil {
+			return nil, err
+		}
+		if max < 0 {
+			continue
+		}
+		if end >= max {
+			return nil, fmt.Errorf("wrong workload id '%d'", end)
+		}
+		for i := start; i <= end; i++ {
+			target[i] = true
+		}
+	}
+
+	if max < 0 {
+		return nil, nil
+	}
+	if !hasInclude {
+		for i := 0; i < max; i++ {
+			included[i] = true
+		}
+	}
+
+	var ids []int
+	for id := range included {
+		if !excluded[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func parseIDRange(term string) (int, int, error) {
+	startStr, endStr, isRange := strings.Cut(term, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error converting workload id '%s' to int", startStr)
+	}
+	if !isRange {
+		return start, start, nil
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error converting workload id '%s' to int", endStr)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid workload id range '%s'", term)
+	}
+	return start, end, nil
+}
+
+func parsePriorityRange(value string) (*int32, *int32, error) {
+	minStr, maxStr, isRange := strings.Cut(value, "..")
+	if !isRange {
+		maxStr = minStr
+	}
+
+	parse := func(s string) (*int32, error) {
+		if s == "" {
+			return nil, nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		p := int32(v)
+		return &p, nil
+	}
+
+	minPriority, err := parse(minStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxPriority, err := parse(maxStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if minPriority == nil && maxPriority == nil {
+		return nil, nil, fmt.Errorf("empty priority range")
+	}
+	return minPriority, maxPriority, nil
+}
+
+func parseOptionalBool(value string) (*bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseIDExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		max     int
+		want    []int
+		wantErr bool
+	}{
+		{expr: "3", max: 10, want: []int{3}},
+		{expr: "1-4,7,9", max: 10, want: []int{1, 2, 3, 4, 7, 9}},
+		{expr: " 2 - 3 , 2 ", max: 10, want: []int{2, 3}},
+		{expr: "0-5,!2,!4-5", max: 10, want: []int{0, 1, 3}},
+		{expr: "!1,!3-4", max: 5, want: []int{0, 2}},
+		{expr: "9", max: 10, want: []int{9}},
+		{expr: "10", max: 10, wantErr: true},
+		{expr: "8-12", max: 10, wantErr: true},
+		{expr: "4-2", max: 10, wantErr: true},
+		{expr: "a", max: 10, wantErr: true},
+		{expr: "1-b", max: 10, wantErr: true},
+		{expr: "-1", max: 10, wantErr: true},
+		// A negative max only validates the syntax, also of huge ranges.
+		{expr: "0-2000000000", max: -1},
+		{expr: "5-1", max: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseIDExpression(tt.expr, tt.max)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIDExpression(%q, %d) error = %v, want error %v", tt.expr, tt.max, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseIDExpression(%q, %d) = %v, want %v", tt.expr, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParsePatternList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    patternList
+		wantErr bool
+	}{
+		{value: "payments", want: patternList{"payments"}},
+		{value: " Payments, team-* ,,!", want: patternList{"payments", "team-*"}},
+		{value: "team-*,!team-test", want: patternList{"team-*", "!team-test"}},
+		{value: "[a-", wantErr: true},
+		{value: "!api[", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePatternList(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePatternList(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parsePatternList(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPatternListMatches(t *testing.T) {
+	tests := []struct {
+		patterns patternList
+		value    string
+		want     bool
+	}{
+		{patterns: nil, value: "anything", want: true},
+		{patterns: patternList{"payments"}, value: "Payments", want: true},
+		{patterns: patternList{"payments"}, value: "orders", want: false},
+		{patterns: patternList{"team-*", "!team-test"}, value: "team-a", want: true},
+		{patterns: patternList{"team-*", "!team-test"}, value: "team-test", want: false},
+		{patterns: patternList{"!kube-system"}, value: "payments", want: true},
+		{patterns: patternList{"!kube-*"}, value: "kube-public", want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.patterns.matches(tt.value); got != tt.want {
+			t.Errorf("%v.matches(%q) = %v, want %v", tt.patterns, tt.value, got, tt.want)
+		}
+	}
+}
@@ -2,14 +2,66 @@ package main
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// CheckStatefulSetIsReady reports whether the StatefulSet rolled out its
+// template to the pods, like kubectl rollout status. The pods of the OnDelete
+// strategy are only replaced when they are deleted, so only their readiness is
+// checked. A partitioned rolling update is complete when the pods from the
+// partition ordinal on are updated.
 func CheckStatefulSetIsReady(sts *appsv1.StatefulSet) bool {
-	return sts.Status.ObservedGeneration == sts.Generation &&
-		sts.Status.Replicas == *sts.Spec.Replicas &&
-		sts.Status.ReadyReplicas == *sts.Spec.Replicas &&
-		sts.Status.CurrentReplicas == *sts.Spec.Replicas
+	replicas := *sts.Spec.Replicas
+	if sts.Status.ObservedGeneration != sts.Generation ||
+		sts.Status.Replicas != replicas ||
+		sts.Status.ReadyReplicas != replicas {
+		return false
+	}
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return true
+	}
+	if update := sts.Spec.UpdateStrategy.RollingUpdate; update != nil && update.Partition != nil && *update.Partition > 0 {
+		return sts.Status.UpdatedReplicas >= replicas-*update.Partition
+	}
+	return sts.Status.UpdatedReplicas == replicas &&
+		sts.Status.CurrentRevision == sts.Status.UpdateRevision
+}
+
+func CheckDaemonSetIsReady(ds *appsv1.DaemonSet) bool {
+	return ds.Status.ObservedGeneration == ds.Generation &&
+		ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberReady == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled
+}
+
+func CheckReplicaSetIsReady(rs *appsv1.ReplicaSet) bool {
+	return rs.Status.ObservedGeneration == rs.Generation &&
+		rs.Status.Replicas == *rs.Spec.Replicas &&
+		rs.Status.ReadyReplicas == *rs.Spec.Replicas &&
+		rs.Status.AvailableReplicas == *rs.Spec.Replicas
+}
+
+// CheckCronJobIsReady reports whether the last scheduled run of the CronJob
+// succeeded or is still running.
+func CheckCronJobIsReady(cj *batchv1.CronJob) bool {
+	if cj.Status.LastScheduleTime == nil || len(cj.Status.Active) > 0 {
+		return true
+	}
+	return cj.Status.LastSuccessfulTime != nil &&
+		!cj.Status.LastSuccessfulTime.Before(cj.Status.LastScheduleTime)
+}
+
+func CheckJobIsReady(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return false
+		}
+		if condition.Type == batchv1.JobComplete && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return job.Status.Active > 0
 }
 
 func CheckDeploymentIsReady(deployment *appsv1.Deployment) bool {
@@ -37,6 +89,7 @@ func CheckDeploymentIsReady(deployment *appsv1.Deployment) bool {
 
 	return deployment.Status.ObservedGeneration == deployment.Generation &&
 		deployment.Status.Replicas == *deployment.Spec.Replicas &&
+		deployment.Status.UpdatedReplicas == *deployment.Spec.Replicas &&
 		deployment.Status.ReadyReplicas == *deployment.Spec.Replicas &&
 		deployment.Status.AvailableReplicas == *deployment.Spec.Replicas &&
 		deployment.Status.Conditions != nil && len(deployment.Status.Conditions) > 0 &&
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestCheckStatefulSetIsReady(t *testing.T) {
+	rolledOut := appsv1.StatefulSetStatus{
+		ObservedGeneration: 2,
+		Replicas:           3,
+		ReadyReplicas:      3,
+		CurrentReplicas:    3,
+		UpdatedReplicas:    3,
+		CurrentRevision:    "web-2",
+		UpdateRevision:     "web-2",
+	}
+	// Right after the patch the controller observed the generation, but all
+	// pods still run the current revision.
+	justPatched := appsv1.StatefulSetStatus{
+		ObservedGeneration: 2,
+		Replicas:           3,
+		ReadyReplicas:      3,
+		CurrentReplicas:    3,
+		UpdatedReplicas:    0,
+		CurrentRevision:    "web-1",
+		UpdateRevision:     "web-2",
+	}
+	partiallyUpdated := justPatched
+	partiallyUpdated.UpdatedReplicas = 1
+	partiallyUpdated.CurrentReplicas = 2
+	// All pods are updated, the controller did not move the current revision yet.
+	revisionPending := rolledOut
+	revisionPending.CurrentRevision = "web-1"
+
+	tests := []struct {
+		name      string
+		status    appsv1.StatefulSetStatus
+		strategy  appsv1.StatefulSetUpdateStrategy
+		generated int64
+		want      bool
+	}{
+		{name: "rolled out", status: rolledOut, want: true},
+		{name: "generation not observed", status: rolledOut, generated: 3},
+		{name: "just patched", status: justPatched},
+		{name: "partially updated", status: partiallyUpdated},
+		{name: "revision pending", status: revisionPending},
+		{name: "pod not ready", status: func() appsv1.StatefulSetStatus { s := rolledOut; s.ReadyReplicas = 2; return s }()},
+		{name: "on delete", status: justPatched,
+			strategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}, want: true},
+		{name: "partition not reached", status: justPatched, strategy: partitioned(2)},
+		{name: "partition reached", status: partiallyUpdated, strategy: partitioned(2), want: true},
+	}
+	for _, tt := range tests {
+		sts := &appsv1.StatefulSet{
+			Spec:   appsv1.StatefulSetSpec{Replicas: ptr.To[int32](3), UpdateStrategy: tt.strategy},
+			Status: tt.status,
+		}
+		sts.Generation = 2
+		if tt.generated != 0 {
+			sts.Generation = tt.generated
+		}
+		if got := CheckStatefulSetIsReady(sts); got != tt.want {
+			t.Errorf("%s: CheckStatefulSetIsReady() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func partitioned(partition int32) appsv1.StatefulSetUpdateStrategy {
+	return appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: ptr.To(partition)},
+	}
+}
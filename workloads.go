@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func printWorkloadsTable(namespace string) error {
@@ -21,105 +26,130 @@ func printWorkloadsTable(namespace string) error {
 	return nil
 }
 
-func getDeploymentsWorkloadPriority(deployment *appsv1.Deployment) int32 {
-	// Get the priority of actual pods
-	pods, err := kubeClient.CoreV1().Pods(deployment.Namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("app=%s", deployment.Name),
-	})
-	if err != nil {
-		fmt.Printf("Failed to get pods for deployment %s/%s, err: %v", deployment.Namespace, deployment.Name, err)
-		return 0
+// getWorkloadPriority returns the priority the pod template resolves to, and
+// the distinct priorities of the pods when they differ from it, e.g. during
+// the rollout of a new priority class. known is false when the priority of the
+// template can not be resolved, then the priorities of the pods are returned.
+func getWorkloadPriority(podSpec *corev1.PodSpec, pods []corev1.Pod) (priority int32, known bool, podPriorities []int32) {
+	priority, known = resolvePriority(podSpec)
+	mixed := !known
+	for i := range pods {
+		podPriority, ok := resolvePriority(&pods[i].Spec)
+		if !ok {
+			continue
+		}
+		mixed = mixed || podPriority != priority
+		if !slices.Contains(podPriorities, podPriority) {
+			podPriorities = append(podPriorities, podPriority)
+		}
 	}
-	if len(pods.Items) == 0 {
-		return 0
+	if !mixed {
+		return priority, known, nil
 	}
-
-	// Get the priority of the first pod, we do not support multiple priority in one deployment now
-	return getPodPriority(&pods.Items[0])
+	slices.Sort(podPriorities)
+	return priority, known, podPriorities
 }
 
-func getStatefulSetWorkloadPriority(statefulSet *appsv1.StatefulSet) int32 {
-	// Get the priority of actual pods
-	pods, err := kubeClient.CoreV1().Pods(statefulSet.Namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("app=%s", statefulSet.Name),
-	})
-	if err != nil {
-		fmt.Printf("Failed to get pods for statefulSet %s/%s, err: %v", statefulSet.Namespace, statefulSet.Name, err)
-		return 0
+// resolvePriority returns the priority of the pod spec like the priority
+// admission does: the priority set by the admission, the value of the priority
+// class, or the value of the globalDefault priority class. It is not known
+// without the cache of the priority classes, e.g. when listing them is
+// forbidden, the inventory reports that once.
+func resolvePriority(podSpec *corev1.PodSpec) (int32, bool) {
+	if podSpec.Priority != nil {
+		return *podSpec.Priority, true
+	}
+	inv, err := getInventory()
+	if err != nil || inv.priorityClasses == nil {
+		return 0, false
+	}
+	if podSpec.PriorityClassName == "" {
+		classes, _ := listCached[*schedulingv1.PriorityClass](inv.priorityClasses, metav1.NamespaceAll, labels.Everything())
+		for _, class := range classes {
+			if class.GlobalDefault {
+				return class.Value, true
+			}
+		}
+		return 0, true
 	}
-	if len(pods.Items) == 0 {
-		return 0
+	class, ok := getCached[*schedulingv1.PriorityClass](inv.priorityClasses, podSpec.PriorityClassName)
+	if !ok {
+		warnMissingPriorityClass(podSpec.PriorityClassName)
+		return 0, true
 	}
+	return class.Value, true
+}
 
-	// Get the priority of the first pod, we do not support multiple priority in one deployment now
-	return getPodPriority(&pods.Items[0])
+var missingPriorityClasses struct {
+	mu     sync.Mutex
+	warned map[string]bool
 }
 
-func getPodPriority(pod *corev1.Pod) int32 {
-	if pod.Spec.PriorityClassName == "" {
-		return 0
+func warnMissingPriorityClass(name string) {
+	missingPriorityClasses.mu.Lock()
+	defer missingPriorityClasses.mu.Unlock()
+	if missingPriorityClasses.warned == nil {
+		missingPriorityClasses.warned = make(map[string]bool)
+	}
+	if !missingPriorityClasses.warned[name] {
+		missingPriorityClasses.warned[name] = true
+		fmt.Fprintf(os.Stderr, "Priority class %s not found\n", name)
 	}
+}
 
-	priorityClass, err := kubeClient.SchedulingV1().PriorityClasses().Get(context.TODO(), pod.Spec.PriorityClassName, metav1.GetOptions{})
-	if err != nil {
-		fmt.Printf("Failed to get priority class %s, err: %v", pod.Spec.PriorityClassName, err)
-		return 0
+// formatPriority shows the priorities of the pods when they differ from the
+// priority of the workload.
+func formatPriority(w Workload) string {
+	priority := fmt.Sprint(w.Priority)
+	if w.PriorityUnknown {
+		priority = "Unknown"
 	}
-	if priorityClass == nil {
-		fmt.Printf("Priority class %s not found", pod.Spec.PriorityClassName)
-		return 0
+	if len(w.PodPriorities) == 0 {
+		return priority
 	}
-
-	return priorityClass.Value
+	podPriorities := make([]string, 0, len(w.PodPriorities))
+	for _, p := range w.PodPriorities {
+		podPriorities = append(podPriorities, fmt.Sprint(p))
+	}
+	return fmt.Sprintf("%s (pods: %s)", priority, strings.Join(podPriorities, ", "))
 }
 
 func getAllWorkloads() ([]Workload, error) {
 	var newWorkloads []Workload
 
-	deployments, err := kubeClient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-	for _, d := range deployments.Items {
-		// Get the priority of the deployment
-		priority := getDeploymentsWorkloadPriority(&d)
-		newWorkloads = append(newWorkloads, Workload{
-			Name:           d.Name,
-			Namespace:      d.Namespace,
-			Kind:           WorkloadDeployment,
-			Replicas:       *d.Spec.Replicas,
-			Available:      d.Status.AvailableReplicas,
-			Ready:          CheckDeploymentIsReady(&d),
-			MigratePatched: CheckWorkloadIsMigrated(d.Spec.Template.Spec.NodeSelector, d.Spec.Template.Spec.Tolerations),
-			ARMPatched:     HasArm64Preference(d.Spec.Template.Spec.Affinity) || CheckWorkloadHasARM64Toleration(d.Spec.Template.Spec.Tolerations),
-			deployment:     &d,
-			Priority:       priority,
-		})
-	}
-
-	statefulSets, err := kubeClient.AppsV1().StatefulSets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+	namespaces := namespaceScope
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
 	}
-	for _, s := range statefulSets.Items {
-		// Get the priority of the statefulSet
-		priority := getStatefulSetWorkloadPriority(&s)
-		newWorkloads = append(newWorkloads, Workload{
-			Name:           s.Name,
-			Namespace:      s.Namespace,
-			Kind:           WorkloadStatefulSet,
-			Replicas:       *s.Spec.Replicas,
-			Available:      s.Status.ReadyReplicas,
-			Ready:          CheckStatefulSetIsReady(&s),
-			MigratePatched: CheckWorkloadIsMigrated(s.Spec.Template.Spec.NodeSelector, s.Spec.Template.Spec.Tolerations),
-			ARMPatched:     HasArm64Preference(s.Spec.Template.Spec.Affinity) || CheckWorkloadHasARM64Toleration(s.Spec.Template.Spec.Tolerations),
-			statefulSet:    &s,
-			Priority:       priority,
-		})
+	for _, cluster := range fleetClusterNames() {
+		if err := useCluster(cluster); err != nil {
+			return nil, err
+		}
+		for _, kind := range workloadKindOrder {
+			for _, namespace := range namespaces {
+				objects, err := workloadKindHandlers[kind].List(context.TODO(), namespace)
+				if err != nil {
+					if cluster != "" {
+						return nil, fmt.Errorf("list %s in cluster %s: %w", kind, cluster, err)
+					}
+					return nil, fmt.Errorf("list %s: %w", kind, err)
+				}
+				for _, obj := range objects {
+					w, err := newWorkload(kind, obj)
+					if err != nil {
+						return nil, err
+					}
+					newWorkloads = append(newWorkloads, w)
+				}
+			}
+		}
 	}
 
 	sort.Slice(newWorkloads, func(i, j int) bool {
 		wi, wj := newWorkloads[i], newWorkloads[j]
+		if wi.Cluster != wj.Cluster {
+			return wi.Cluster < wj.Cluster
+		}
 		// Sort by priority first
 		if wi.Namespace != wj.Namespace {
 			return wi.Namespace < wj.Namespace
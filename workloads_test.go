@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// testPriorityClasses replaces the priority classes of the inventory, nil
+// values mean they could not be cached.
+func testPriorityClasses(t *testing.T, values map[string]int32, globalDefault int32) {
+	t.Helper()
+	var classes []metav1.Object
+	for name, value := range values {
+		classes = append(classes, &schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: name}, Value: value})
+	}
+	if globalDefault != 0 {
+		classes = append(classes, &schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Value: globalDefault, GlobalDefault: true})
+	}
+	inv := testInventory(t, classes...)
+	if values == nil {
+		inv.priorityClasses = nil
+	}
+}
+
+func TestResolvePriority(t *testing.T) {
+	classes := map[string]int32{"high": 1000, "low": -10}
+	tests := []struct {
+		name          string
+		classes       map[string]int32
+		globalDefault int32
+		podSpec       corev1.PodSpec
+		want          int32
+		wantKnown     bool
+	}{
+		{name: "set by the admission", classes: classes, podSpec: corev1.PodSpec{Priority: ptr.To[int32](7),
+			PriorityClassName: "high"}, want: 7, wantKnown: true},
+		{name: "priority class", classes: classes, podSpec: corev1.PodSpec{PriorityClassName: "high"}, want: 1000,
+			wantKnown: true},
+		{name: "negative priority class", classes: classes, podSpec: corev1.PodSpec{PriorityClassName: "low"}, want: -10,
+			wantKnown: true},
+		{name: "missing priority class", classes: classes, podSpec: corev1.PodSpec{PriorityClassName: "gone"},
+			wantKnown: true},
+		{name: "global default", classes: classes, globalDefault: 100, want: 100, wantKnown: true},
+		{name: "no global default", classes: classes, wantKnown: true},
+		{name: "classes not listed", podSpec: corev1.PodSpec{PriorityClassName: "high"}},
+		{name: "classes not listed, set by the admission", podSpec: corev1.PodSpec{Priority: ptr.To[int32](7)},
+			want: 7, wantKnown: true},
+	}
+	for _, tt := range tests {
+		testPriorityClasses(t, tt.classes, tt.globalDefault)
+		got, known := resolvePriority(&tt.podSpec)
+		if got != tt.want || known != tt.wantKnown {
+			t.Errorf("%s: resolvePriority() = %d, %v, want %d, %v", tt.name, got, known, tt.want, tt.wantKnown)
+		}
+	}
+}
+
+func TestGetWorkloadPriority(t *testing.T) {
+	testPriorityClasses(t, map[string]int32{"high": 1000}, 0)
+	pod := func(priority int32) corev1.Pod {
+		return corev1.Pod{Spec: corev1.PodSpec{Priority: ptr.To(priority)}}
+	}
+
+	tests := []struct {
+		name              string
+		podSpec           corev1.PodSpec
+		pods              []corev1.Pod
+		want              int32
+		wantPodPriorities []int32
+	}{
+		{name: "same priority", podSpec: corev1.PodSpec{PriorityClassName: "high"},
+			pods: []corev1.Pod{pod(1000), pod(1000)}, want: 1000},
+		{name: "rolling out", podSpec: corev1.PodSpec{PriorityClassName: "high"},
+			pods: []corev1.Pod{pod(1000), pod(0), pod(1000)}, want: 1000, wantPodPriorities: []int32{0, 1000}},
+		{name: "default priority", pods: []corev1.Pod{pod(0)}},
+	}
+	for _, tt := range tests {
+		got, known, podPriorities := getWorkloadPriority(&tt.podSpec, tt.pods)
+		if got != tt.want || !known || !slices.Equal(podPriorities, tt.wantPodPriorities) {
+			t.Errorf("%s: getWorkloadPriority() = %d, %v, %v, want %d, true, %v", tt.name, got, known, podPriorities,
+				tt.want, tt.wantPodPriorities)
+		}
+	}
+}